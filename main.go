@@ -1,8 +1,75 @@
 package main
 
-import "github.com/mat285/interpreter/pkg/interpreter"
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/mat285/interpreter/pkg/dap"
+	"github.com/mat285/interpreter/pkg/interpreter"
+	"github.com/mat285/interpreter/pkg/lsp"
+	"github.com/mat285/interpreter/pkg/parser"
+)
 
 func main() {
+	if len(os.Args) > 1 {
+		var err error
+		switch os.Args[1] {
+		case "dap":
+			err = dap.NewServer(os.Stdin, os.Stdout).Serve()
+		case "lsp":
+			err = lsp.NewServer(os.Stdin, os.Stdout).Serve()
+		case "fmt":
+			err = format(os.Args[2:])
+		default:
+			err = fmt.Errorf("Unknown command `%s`. Commands are dap, lsp and fmt", os.Args[1])
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 	i := interpreter.New()
 	i.Start()
 }
+
+// format formats the files, or stdin if there are none, writing to stdout unless -w is given
+func format(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	write := flags.Bool("w", false, "write the result to the file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		out, err := parser.Format(string(src))
+		if err != nil {
+			return err
+		}
+		fmt.Print(out)
+		return nil
+	}
+	for _, file := range flags.Args() {
+		src, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		out, err := parser.Format(string(src))
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		if !*write {
+			fmt.Print(out)
+		} else if out != string(src) {
+			if err := ioutil.WriteFile(file, []byte(out), 0644); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
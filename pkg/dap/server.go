@@ -0,0 +1,433 @@
+package dap
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/mat285/interpreter/pkg/parser"
+	"github.com/mat285/interpreter/pkg/wire"
+)
+
+const (
+	threadID   = 1
+	threadName = "main"
+)
+
+// Server is a debug adapter that runs a script file under the debugger, speaking the debug
+// adapter protocol. Breakpoints are set on the lines of `let` definitions, and stop each call
+// to the defined function. The debugger stops on calls rather than lines, so a breakpoint on any
+// line of a definition that spans several lines stops on entry to the function
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	lock        sync.Mutex
+	seq         int
+	runtime     *parser.Runtime
+	debugger    *parser.Debugger
+	program     string
+	statements  []parser.Statement
+	stopOnEntry bool
+	launched    bool
+	configured  bool
+	statement   parser.Statement
+	stop        *parser.Stop
+	entry       bool
+	resume      chan parser.Action
+	resumeWith  *parser.Action
+	cancel      context.CancelFunc
+	// breakpoints are the ids of the breakpoints set in each source file
+	breakpoints map[string][]int
+}
+
+// NewServer creates a server reading requests from in and writing responses and events to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	s := &Server{
+		in:          bufio.NewReader(in),
+		out:         out,
+		runtime:     parser.NewRuntime(),
+		resume:      make(chan parser.Action),
+		breakpoints: map[string][]int{},
+	}
+	s.debugger = parser.NewDebugger(s.runtime, s.stopped)
+	return s
+}
+
+// Serve handles requests until the client disconnects or the input ends
+func (s *Server) Serve() error {
+	defer s.abort()
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Type != "request" {
+			continue
+		}
+		body, err := s.handle(msg)
+		resp := &response{Type: "response", RequestSeq: msg.Seq, Command: msg.Command, Success: err == nil, Body: body}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := s.send(resp); err != nil {
+			return err
+		}
+		if s.resumeWith != nil {
+			s.resume <- *s.resumeWith
+			s.resumeWith = nil
+		}
+		switch msg.Command {
+		case "initialize":
+			s.event("initialized", nil)
+		case "launch", "configurationDone":
+			s.start()
+		case "disconnect", "terminate":
+			return nil
+		}
+	}
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch msg.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+		}, nil
+	case "launch":
+		args := &launchArguments{}
+		if err := unmarshal(msg, args); err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		args := &setBreakpointsArguments{}
+		if err := unmarshal(msg, args); err != nil {
+			return nil, err
+		}
+		bps, err := s.setBreakpoints(args)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"breakpoints": bps}, nil
+	case "configurationDone":
+		s.lock.Lock()
+		s.configured = true
+		s.lock.Unlock()
+		return nil, nil
+	case "threads":
+		return map[string]interface{}{"threads": []thread{{ID: threadID, Name: threadName}}}, nil
+	case "stackTrace":
+		frames := s.stackTrace()
+		return map[string]interface{}{"stackFrames": frames, "totalFrames": len(frames)}, nil
+	case "scopes":
+		args := &frameArguments{}
+		if err := unmarshal(msg, args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"scopes": []scope{{Name: "Arguments", VariablesReference: args.FrameID}}}, nil
+	case "variables":
+		args := &variablesArguments{}
+		if err := unmarshal(msg, args); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"variables": s.variables(args.VariablesReference)}, nil
+	case "evaluate":
+		args := &evaluateArguments{}
+		if err := unmarshal(msg, args); err != nil {
+			return nil, err
+		}
+		val, err := s.evaluate(args)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"result": fmt.Sprintf("%d", val), "variablesReference": 0}, nil
+	case "continue":
+		return map[string]bool{"allThreadsContinued": true}, s.continueWith(parser.Continue)
+	case "next":
+		return nil, s.continueWith(parser.StepOver)
+	case "stepIn":
+		return nil, s.continueWith(parser.StepIn)
+	case "stepOut":
+		return nil, s.continueWith(parser.StepOut)
+	case "disconnect", "terminate":
+		s.abort()
+		return nil, nil
+	}
+	return nil, fmt.Errorf("Unsupported request `%s`", msg.Command)
+}
+
+func (s *Server) launch(args *launchArguments) error {
+	stmts, err := readFile(args.Program)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.program = args.Program
+	s.statements = stmts
+	s.stopOnEntry = args.StopOnEntry
+	s.launched = true
+	return nil
+}
+
+// setBreakpoints replaces the breakpoints of the source with one on the function defined on
+// each line, keeping the breakpoints of other sources. Each breakpoint is reported on the line
+// it was requested on, with a message saying that it stops on calls to the function
+func (s *Server) setBreakpoints(args *setBreakpointsArguments) ([]breakpoint, error) {
+	stmts, err := readFile(args.Source.Path)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Clean(args.Source.Path)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, id := range s.breakpoints[path] {
+		s.debugger.Delete(id)
+	}
+	delete(s.breakpoints, path)
+	bps := make([]breakpoint, 0, len(args.Breakpoints))
+	for _, sb := range args.Breakpoints {
+		bp := breakpoint{Line: sb.Line, Message: "Breakpoints must be on a let definition"}
+		for _, stmt := range stmts {
+			if sb.Line < stmt.Line || sb.Line > stmt.EndLine || !parser.IsDefinition(stmt.Source) {
+				continue
+			}
+			f, err := parser.ParseFunction(stmt.Source, parser.NewContext())
+			if err != nil {
+				bp.Message = err.Error()
+				break
+			}
+			b, err := s.debugger.Break(*f.Name, sb.Condition)
+			if err != nil {
+				bp.Message = err.Error()
+				break
+			}
+			s.breakpoints[path] = append(s.breakpoints[path], b.ID)
+			bp = breakpoint{ID: b.ID, Verified: true, Line: sb.Line, Message: fmt.Sprintf("Stops on each call to `%s`", *f.Name)}
+			break
+		}
+		bps = append(bps, bp)
+	}
+	return bps, nil
+}
+
+// start runs the program once it is launched and configured
+func (s *Server) start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.launched || !s.configured || s.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.entry = s.stopOnEntry
+	go s.run(ctx, s.statements)
+}
+
+func (s *Server) run(ctx context.Context, stmts []parser.Statement) {
+	for _, stmt := range stmts {
+		if ctx.Err() != nil || !s.runStatement(ctx, stmt) {
+			break
+		}
+	}
+	s.event("terminated", nil)
+	s.event("exited", map[string]int{"exitCode": 0})
+}
+
+// runStatement runs the statement, writing its result or error to the output. It returns
+// false if the program was aborted. A panic is reported like an error of the statement, as it
+// runs on its own goroutine and would otherwise end the adapter
+func (s *Server) runStatement(ctx context.Context, stmt parser.Statement) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.output("stderr", fmt.Sprintf("Line %d: %v\n", stmt.Line, r))
+			ok = true
+		}
+	}()
+	if parser.IsModuleDeclaration(stmt.Source) {
+		return true
+	} else if parser.IsImport(stmt.Source) {
+		if _, err := s.runtime.Import(stmt.Source, filepath.Dir(s.program)); err != nil {
+			s.output("stderr", fmt.Sprintf("Line %d: %v\n", stmt.Line, err))
+		}
+		return true
+	} else if parser.IsDefinition(stmt.Source) {
+		if _, err := s.runtime.DefineStatement(stmt); err != nil {
+			s.output("stderr", fmt.Sprintf("Line %d: %v\n", stmt.Line, err))
+		}
+		return true
+	}
+	s.lock.Lock()
+	s.statement = stmt
+	entry := s.entry
+	s.lock.Unlock()
+	val, err := s.debugger.Eval(ctx, stmt.Source, entry)
+	if err == parser.ErrAborted {
+		return false
+	} else if err != nil {
+		s.output("stderr", fmt.Sprintf("Line %d: %v\n", stmt.Line, err))
+		return true
+	}
+	s.output("stdout", fmt.Sprintf("%d\n", val))
+	return true
+}
+
+// stopped is called by the debugger on the evaluating goroutine, and waits for the client to resume
+func (s *Server) stopped(stop *parser.Stop) parser.Action {
+	s.lock.Lock()
+	reason := "step"
+	if stop.Breakpoint != nil {
+		reason = "breakpoint"
+	} else if s.entry {
+		reason = "entry"
+	}
+	s.entry = false
+	s.stop = stop
+	s.lock.Unlock()
+
+	body := map[string]interface{}{"reason": reason, "threadId": threadID, "allThreadsStopped": true}
+	if stop.Breakpoint != nil {
+		body["hitBreakpointIds"] = []int{stop.Breakpoint.ID}
+	}
+	s.event("stopped", body)
+	return <-s.resume
+}
+
+// continueWith resumes the stopped program with the action once the response is sent
+func (s *Server) continueWith(action parser.Action) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stop == nil {
+		return fmt.Errorf("The program is not stopped")
+	}
+	s.stop = nil
+	s.resumeWith = &action
+	return nil
+}
+
+// abort stops the program if it is running
+func (s *Server) abort() {
+	s.lock.Lock()
+	cancel := s.cancel
+	stopped := s.stop != nil
+	s.lock.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	if stopped && s.continueWith(parser.Abort) == nil {
+		s.resume <- *s.resumeWith
+		s.resumeWith = nil
+	}
+}
+
+// frames returns the calls in progress, innermost first, followed by the statement being evaluated.
+// The frame for the statement is nil
+func (s *Server) frames() []*parser.Frame {
+	if s.stop == nil {
+		return nil
+	}
+	frames := make([]*parser.Frame, 0, len(s.stop.Stack)+1)
+	for i := len(s.stop.Stack) - 1; i >= 0; i-- {
+		frames = append(frames, s.stop.Stack[i])
+	}
+	return append(frames, nil)
+}
+
+func (s *Server) frame(id int) *parser.Frame {
+	frames := s.frames()
+	if id < 1 || id > len(frames) {
+		return nil
+	}
+	return frames[id-1]
+}
+
+func (s *Server) stackTrace() []stackFrame {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	src := source{Name: filepath.Base(s.program), Path: s.program}
+	ret := []stackFrame{}
+	for i, frame := range s.frames() {
+		sf := stackFrame{ID: i + 1, Name: s.statement.Source, Source: src, Line: s.statement.Line, Column: 1}
+		if frame != nil {
+			sf.Name = frame.String()
+			if frame.Line > 0 {
+				sf.Line = frame.Line
+			}
+		}
+		ret = append(ret, sf)
+	}
+	return ret
+}
+
+func (s *Server) variables(ref int) []variable {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := []variable{}
+	frame := s.frame(ref)
+	if frame == nil {
+		return ret
+	}
+	for name, v := range frame.Locals {
+		ret = append(ret, variable{Name: name, Value: v.String()})
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+func (s *Server) evaluate(args *evaluateArguments) (parser.Value, error) {
+	s.lock.Lock()
+	frame := s.frame(args.FrameID)
+	s.lock.Unlock()
+	if frame != nil {
+		return s.debugger.EvalFrame(frame, args.Expression)
+	}
+	return s.runtime.Eval(args.Expression)
+}
+
+func (s *Server) output(category, text string) {
+	s.event("output", map[string]string{"category": category, "output": text})
+}
+
+func (s *Server) event(name string, body interface{}) {
+	s.send(&event{Type: "event", Event: name, Body: body})
+}
+
+// send writes the message with the next sequence number
+func (s *Server) send(msg interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seq++
+	switch m := msg.(type) {
+	case *response:
+		m.Seq = s.seq
+	case *event:
+		m.Seq = s.seq
+	}
+	return wire.Write(s.out, msg)
+}
+
+func unmarshal(msg *message, v interface{}) error {
+	if len(msg.Arguments) == 0 {
+		return nil
+	}
+	return json.Unmarshal(msg.Arguments, v)
+}
+
+func readFile(path string) ([]parser.Statement, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parser.ReadStatements(f)
+}
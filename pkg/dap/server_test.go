@@ -0,0 +1,239 @@
+package dap
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mat285/interpreter/pkg/parser"
+	"github.com/mat285/interpreter/pkg/wire"
+)
+
+// received is a response or event read by the test client
+type received struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Body    json.RawMessage `json:"body"`
+}
+
+// client drives a server over pipes, reading its messages as they are sent like an editor does
+type client struct {
+	t      *testing.T
+	seq    int
+	in     *io.PipeWriter
+	msgs   chan *received
+	done   chan error
+	server *Server
+}
+
+func newClient(t *testing.T) *client {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	c := &client{t: t, in: inW, msgs: make(chan *received, 64), done: make(chan error, 1), server: NewServer(inR, outW)}
+	go func() {
+		err := c.server.Serve()
+		outW.Close()
+		c.done <- err
+	}()
+	go func() {
+		defer close(c.msgs)
+		out := bufio.NewReader(outR)
+		for {
+			body, err := wire.Read(out)
+			if err != nil {
+				return
+			}
+			msg := &received{}
+			if err := json.Unmarshal(body, msg); err != nil {
+				return
+			}
+			c.msgs <- msg
+		}
+	}()
+	return c
+}
+
+// request sends the request and returns its response, checking that it succeeded
+func (c *client) request(command string, args interface{}) *received {
+	c.t.Helper()
+	c.seq++
+	raw, err := json.Marshal(args)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := wire.Write(c.in, &message{Seq: c.seq, Type: "request", Command: command, Arguments: raw}); err != nil {
+		c.t.Fatal(err)
+	}
+	resp := c.expect("response", command)
+	if !resp.Success {
+		c.t.Fatalf("%s failed: %s", command, resp.Message)
+	}
+	return resp
+}
+
+// expect reads messages until one of the type with the command or event name
+func (c *client) expect(kind, name string) *received {
+	c.t.Helper()
+	for msg := range c.msgs {
+		if msg.Type == kind && (msg.Command == name || msg.Event == name) {
+			return msg
+		}
+	}
+	c.t.Fatalf("Expected %s %s before the server ended", kind, name)
+	return nil
+}
+
+func (c *client) decode(msg *received, v interface{}) {
+	c.t.Helper()
+	if err := json.Unmarshal(msg.Body, v); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func TestSession(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "main.fn")
+	src := "let f x = x +\n  1\nf(2) * 2\n"
+	if err := os.WriteFile(program, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t)
+	c.request("initialize", map[string]string{"adapterID": "interpreter"})
+	c.expect("event", "initialized")
+	c.request("launch", launchArguments{Program: program})
+
+	resp := c.request("setBreakpoints", setBreakpointsArguments{
+		Source:      source{Path: program},
+		Breakpoints: []sourceBreakpoint{{Line: 2}, {Line: 3}},
+	})
+	bps := struct{ Breakpoints []breakpoint }{}
+	c.decode(resp, &bps)
+	if len(bps.Breakpoints) != 2 || !bps.Breakpoints[0].Verified || bps.Breakpoints[0].Line != 2 {
+		t.Fatalf("Expected a verified breakpoint on line 2, found %+v", bps.Breakpoints)
+	}
+	if bps.Breakpoints[1].Verified {
+		t.Fatalf("Expected the breakpoint outside a definition not to be verified, found %+v", bps.Breakpoints[1])
+	}
+
+	c.request("configurationDone", nil)
+	stopped := struct{ Reason string }{}
+	c.decode(c.expect("event", "stopped"), &stopped)
+	if stopped.Reason != "breakpoint" {
+		t.Fatalf("Expected to stop at the breakpoint, found %s", stopped.Reason)
+	}
+
+	trace := struct{ StackFrames []stackFrame }{}
+	c.decode(c.request("stackTrace", map[string]int{"threadId": threadID}), &trace)
+	if len(trace.StackFrames) != 2 || trace.StackFrames[0].Line != 1 || trace.StackFrames[1].Line != 3 {
+		t.Fatalf("Expected the call to f on line 1 within the statement on line 3, found %+v", trace.StackFrames)
+	}
+	vars := struct{ Variables []variable }{}
+	c.decode(c.request("variables", variablesArguments{VariablesReference: trace.StackFrames[0].ID}), &vars)
+	if len(vars.Variables) != 1 || vars.Variables[0].Name != "x" || vars.Variables[0].Value != "2" {
+		t.Fatalf("Expected x = 2, found %+v", vars.Variables)
+	}
+
+	c.request("continue", map[string]int{"threadId": threadID})
+	output := struct{ Category, Output string }{}
+	c.decode(c.expect("event", "output"), &output)
+	if output.Category != "stdout" || output.Output != "6\n" {
+		t.Fatalf("Expected the result 6, found %+v", output)
+	}
+	c.expect("event", "terminated")
+
+	c.request("disconnect", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDisconnectWhileStopped(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "main.fn")
+	if err := os.WriteFile(program, []byte("let f x = x\nf(1)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", launchArguments{Program: program, StopOnEntry: true})
+	c.request("configurationDone", nil)
+	stopped := struct{ Reason string }{}
+	c.decode(c.expect("event", "stopped"), &stopped)
+	if stopped.Reason != "entry" {
+		t.Fatalf("Expected to stop on entry, found %s", stopped.Reason)
+	}
+	c.request("disconnect", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBreakpointsPerSource(t *testing.T) {
+	dir := t.TempDir()
+	program := filepath.Join(dir, "main.fn")
+	lib := filepath.Join(dir, "lib.fn")
+	if err := os.WriteFile(program, []byte("import \"lib\"\nlet f x = sq(x)\nf(2)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(lib, []byte("let sq x = x * x\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t)
+	c.request("initialize", nil)
+	c.request("launch", launchArguments{Program: program})
+	c.request("setBreakpoints", setBreakpointsArguments{Source: source{Path: program}, Breakpoints: []sourceBreakpoint{{Line: 2}}})
+	c.request("setBreakpoints", setBreakpointsArguments{Source: source{Path: lib}, Breakpoints: []sourceBreakpoint{{Line: 1}}})
+	// setting the breakpoints of a source again replaces only its own
+	c.request("setBreakpoints", setBreakpointsArguments{Source: source{Path: lib}, Breakpoints: []sourceBreakpoint{{Line: 1}}})
+	if bps := c.server.debugger.Breakpoints(); len(bps) != 2 || bps[0].Function != "f" || bps[1].Function != "sq" {
+		t.Fatalf("Expected breakpoints on f and sq, found %+v", bps)
+	}
+
+	c.request("configurationDone", nil)
+	for _, want := range []int{1, 2} {
+		trace := struct{ StackFrames []stackFrame }{}
+		c.expect("event", "stopped")
+		c.decode(c.request("stackTrace", map[string]int{"threadId": threadID}), &trace)
+		if len(trace.StackFrames) != want+1 {
+			t.Fatalf("Expected %d calls, found %+v", want, trace.StackFrames)
+		}
+		c.request("continue", map[string]int{"threadId": threadID})
+	}
+	c.expect("event", "terminated")
+	c.request("disconnect", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPanicInScript(t *testing.T) {
+	program := filepath.Join(t.TempDir(), "main.fn")
+	if err := os.WriteFile(program, []byte("boom(1)\n1 + 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := newClient(t)
+	if err := c.server.runtime.RegisterFunc("boom", 1, func([]parser.Value) (parser.Value, error) { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	c.request("initialize", nil)
+	c.request("launch", launchArguments{Program: program})
+	c.request("configurationDone", nil)
+	output := struct{ Category, Output string }{}
+	c.decode(c.expect("event", "output"), &output)
+	if output.Category != "stderr" || output.Output != "Line 1: boom\n" {
+		t.Fatalf("Expected the panic on line 1, found %+v", output)
+	}
+	c.decode(c.expect("event", "output"), &output)
+	if output.Category != "stdout" || output.Output != "3\n" {
+		t.Fatalf("Expected the next statement to run, found %+v", output)
+	}
+	c.expect("event", "terminated")
+	c.request("disconnect", nil)
+	if err := <-c.done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,144 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Command is a meta command, run by entering `:` followed by its name or one of its aliases
+type Command struct {
+	Name    string
+	Aliases []string
+	// Usage shows the arguments of the command, such as `import [filename]`
+	Usage string
+	// Help describes what the command does
+	Help string
+	// MinArgs and MaxArgs bound the number of arguments. A negative MaxArgs is unbounded
+	MinArgs int
+	MaxArgs int
+	// Raw passes the text after the name as the only argument instead of splitting it into words
+	Raw bool
+	// Replay keeps the command in saved session scripts. It is only set for commands that build
+	// up the session, and not for commands that write files, reset the session or wait for input
+	Replay bool
+	// Run runs the command
+	Run func(i *Interpreter, args []string) error
+}
+
+// RegisterCommand adds the command to the interpreter. Names and aliases are case insensitive
+// and must not already be registered
+func (i *Interpreter) RegisterCommand(c *Command) error {
+	if c == nil || c.Run == nil {
+		return fmt.Errorf("Cannot register a command without a handler")
+	}
+	names := append([]string{c.Name}, c.Aliases...)
+	seen := map[string]bool{}
+	for _, name := range names {
+		if len(name) == 0 || strings.IndexFunc(name, unicode.IsSpace) >= 0 || strings.HasPrefix(name, commandPrefix) {
+			return fmt.Errorf("Invalid command name `%s`", name)
+		}
+		if _, ok := i.commands[strings.ToLower(name)]; ok || seen[strings.ToLower(name)] {
+			return fmt.Errorf("Command `%s%s` is already registered", commandPrefix, name)
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	for _, name := range names {
+		i.commands[strings.ToLower(name)] = c
+	}
+	i.commandList = append(i.commandList, c)
+	return nil
+}
+
+// Commands returns the registered commands in the order they were registered
+func (i *Interpreter) Commands() []*Command {
+	return append([]*Command{}, i.commandList...)
+}
+
+// commandNames returns the names and aliases of the registered commands
+func (i *Interpreter) commandNames() []string {
+	names := make([]string, 0, len(i.commands))
+	for name := range i.commands {
+		names = append(names, name)
+	}
+	return names
+}
+
+// parseCommand parses a `:` command line, returning nil if the input is not a command line
+func (i *Interpreter) parseCommand(input string) (*Command, []string, error) {
+	name, rest, ok := splitCommand(input)
+	if !ok {
+		return nil, nil, nil
+	}
+	c, ok := i.commands[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("Unknown command `%s%s`. Use %s%s to list commands", commandPrefix, name, commandPrefix, CommandHelp)
+	}
+	if c.Raw {
+		return c, []string{rest}, nil
+	}
+	args, err := tokenize(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) < c.MinArgs || (c.MaxArgs >= 0 && len(args) > c.MaxArgs) {
+		return nil, nil, fmt.Errorf("Wrong number of arguments for %s%s. Syntax: %s%s", commandPrefix, c.Name, commandPrefix, c.Usage)
+	}
+	return c, args, nil
+}
+
+// splitCommand splits a `:` command line into the lower case command name and the text after it
+func splitCommand(input string) (string, string, bool) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, commandPrefix) {
+		return "", "", false
+	}
+	input = strings.TrimPrefix(input, commandPrefix)
+	end := strings.IndexFunc(input, unicode.IsSpace)
+	if end < 0 {
+		end = len(input)
+	}
+	return strings.ToLower(input[:end]), strings.TrimSpace(input[end:]), true
+}
+
+// tokenize splits the input into words separated by spaces. Quotes group words containing spaces,
+// and a backslash escapes the next character outside of single quotes
+func tokenize(input string) ([]string, error) {
+	tokens := []string{}
+	token := []rune{}
+	inToken := false
+	var quote rune
+	runes := []rune(input)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case r == '\\' && quote != '\'' && i+1 < len(runes):
+			i++
+			token = append(token, runes[i])
+			inToken = true
+		case quote != 0:
+			token = append(token, r)
+		case r == '"' || r == '\'':
+			quote = r
+			inToken = true
+		case unicode.IsSpace(r):
+			if inToken {
+				tokens = append(tokens, string(token))
+				token = []rune{}
+				inToken = false
+			}
+		default:
+			token = append(token, r)
+			inToken = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Missing closing quote %c", quote)
+	}
+	if inToken {
+		tokens = append(tokens, string(token))
+	}
+	return tokens, nil
+}
@@ -0,0 +1,123 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	for _, c := range []struct {
+		input string
+		want  []string
+	}{
+		{input: "", want: []string{}},
+		{input: "  save   out.fn ", want: []string{"save", "out.fn"}},
+		{input: `"my file.fn" 'other file.fn'`, want: []string{"my file.fn", "other file.fn"}},
+		{input: `my\ file.fn`, want: []string{"my file.fn"}},
+		{input: `"say \"hi\"" 'back\slash'`, want: []string{`say "hi"`, `back\slash`}},
+		{input: `dir/"a b"/c.fn ""`, want: []string{"dir/a b/c.fn", ""}},
+		{input: `it\'s`, want: []string{"it's"}},
+		{input: `'C:\dir\'`, want: []string{`C:\dir\`}},
+	} {
+		found, err := tokenize(c.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(found, "|") != strings.Join(c.want, "|") || len(found) != len(c.want) {
+			t.Errorf("%s: expected %q, found %q", c.input, c.want, found)
+		}
+	}
+	for _, input := range []string{`"open`, `'open`, `"escaped\"`} {
+		if _, err := tokenize(input); err == nil || !strings.Contains(err.Error(), "Missing closing quote") {
+			t.Errorf("%s: expected a missing quote error, found %v", input, err)
+		}
+	}
+}
+
+func TestRegisterCommand(t *testing.T) {
+	i := New()
+	ran := []string{}
+	double := &Command{
+		Name:    "double",
+		Aliases: []string{"dbl"},
+		Usage:   "double [word]",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Run: func(i *Interpreter, args []string) error {
+			ran = append(ran, args[0]+args[0])
+			return nil
+		},
+	}
+	if err := i.RegisterCommand(double); err != nil {
+		t.Fatal(err)
+	}
+	if commands := i.Commands(); commands[len(commands)-1] != double {
+		t.Errorf("Expected the command to be registered last")
+	}
+	for _, input := range []string{":double ab", "  :DBL 'ab'"} {
+		c, args, err := i.parseCommand(input)
+		if err != nil || c != double {
+			t.Fatalf("%s: expected the double command, found %v %v", input, c, err)
+		}
+		if err := c.Run(i, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if strings.Join(ran, " ") != "abab abab" {
+		t.Errorf("Expected the command to run twice, found %v", ran)
+	}
+
+	for input, want := range map[string]string{
+		":double":       "Wrong number of arguments for :double. Syntax: :double [word]",
+		":dbl a b":      "Wrong number of arguments",
+		":triple a":     "Unknown command `:triple`",
+		":double 'a":    "Missing closing quote",
+		"double a":      "",
+		"1 + :double a": "",
+	} {
+		c, _, err := i.parseCommand(input)
+		if want == "" {
+			if c != nil || err != nil {
+				t.Errorf("%s: expected not to be a command, found %v %v", input, c, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, found %v", input, want, err)
+		}
+	}
+}
+
+func TestRegisterCommandCollisions(t *testing.T) {
+	i := New()
+	run := func(*Interpreter, []string) error { return nil }
+	count := len(i.Commands())
+	for _, c := range []struct {
+		command *Command
+		want    string
+	}{
+		{command: &Command{Name: CommandHelp, Run: run}, want: "Command `:help` is already registered"},
+		{command: &Command{Name: "HELP", Run: run}, want: "Command `:HELP` is already registered"},
+		{command: &Command{Name: "assist", Aliases: []string{CommandSyntax}, Run: run}, want: "is already registered"},
+		{command: &Command{Name: "twice", Aliases: []string{"Twice"}, Run: run}, want: "Command `:Twice` is already registered"},
+		{command: &Command{Name: "", Run: run}, want: "Invalid command name"},
+		{command: &Command{Name: "two words", Run: run}, want: "Invalid command name"},
+		{command: &Command{Name: ":colon", Run: run}, want: "Invalid command name"},
+		{command: &Command{Name: "norun"}, want: "without a handler"},
+		{command: nil, want: "without a handler"},
+	} {
+		if err := i.RegisterCommand(c.command); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("Expected an error containing %q, found %v", c.want, err)
+		}
+	}
+	// a failed registration registers none of the names
+	if len(i.Commands()) != count {
+		t.Errorf("Expected %d commands, found %d", count, len(i.Commands()))
+	}
+	for _, name := range []string{"assist", "twice", "norun"} {
+		if c, _, _ := i.parseCommand(commandPrefix + name); c != nil {
+			t.Errorf("Expected %s not to be registered", name)
+		}
+	}
+	if c, _, _ := i.parseCommand(commandPrefix + CommandSyntax); c == nil || c.Name != CommandHelp {
+		t.Errorf("Expected %s to still run %s, found %v", CommandSyntax, CommandHelp, c)
+	}
+}
@@ -0,0 +1,462 @@
+package interpreter
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mat285/interpreter/pkg/parser"
+)
+
+func defaultCommands() []*Command {
+	return []*Command{
+		{
+			Name:    CommandHelp,
+			Aliases: []string{CommandSyntax},
+			Usage:   CommandHelp + " [name]",
+			Help:    "show the syntax, commands and builtins, or the doc of a function or command",
+			MaxArgs: 1,
+			Run:     (*Interpreter).helpCmd,
+		},
+		{
+			Name:    CommandQuit,
+			Aliases: []string{CommandExit},
+			Usage:   CommandQuit,
+			Help:    "end the session",
+			Run:     (*Interpreter).quitCmd,
+		},
+		{
+			Name:    CommandEnv,
+			Aliases: []string{CommandContext},
+			Usage:   CommandEnv,
+			Help:    "list the definitions in the environment",
+			Run:     (*Interpreter).envCmd,
+		},
+		{
+			Name:  CommandClear,
+			Usage: CommandClear,
+			Help:  "remove all definitions from the environment",
+			Run:   (*Interpreter).clearCmd,
+		},
+		{
+			Name:    CommandHistory,
+			Usage:   CommandHistory + " [" + historyClear + "|" + historySave + " filename]",
+			Help:    "list, clear or save the statements of this session",
+			MaxArgs: 2,
+			Run:     (*Interpreter).historyCmd,
+		},
+		{
+			Name:    CommandImport,
+			Usage:   CommandImport + " [filename]",
+			Help:    "run the statements in the file",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Replay:  true,
+			Run:     (*Interpreter).importCmd,
+		},
+		{
+			Name:    CommandExport,
+			Usage:   CommandExport + " [filename]",
+			Help:    "write the variables and definitions to the file as a script",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     (*Interpreter).exportCmd,
+		},
+		{
+			Name:    CommandSave,
+			Usage:   CommandSave + " [filename]",
+			Help:    "write a snapshot of the session to the file",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     (*Interpreter).saveCmd,
+		},
+		{
+			Name:    CommandRestore,
+			Usage:   CommandRestore + " [filename]",
+			Help:    "replace the session with the snapshot in the file",
+			MinArgs: 1,
+			MaxArgs: 1,
+			Run:     (*Interpreter).restoreCmd,
+		},
+		{
+			Name:   CommandSet,
+			Usage:  CommandSet + " [name] [expression]",
+			Help:   "set the variable to the value of the expression",
+			Raw:    true,
+			Replay: true,
+			Run:    (*Interpreter).setCmd,
+		},
+		{
+			Name:   CommandOverride,
+			Usage:  CommandOverride + " [funcdef]",
+			Help:   "define a function replacing the builtin with the same name",
+			Raw:    true,
+			Replay: true,
+			Run:    (*Interpreter).overrideCmd,
+		},
+		{
+			Name:  CommandType,
+			Usage: CommandType + " [expression]",
+			Help:  "infer the type of the expression without evaluating it",
+			Raw:   true,
+			Run:   (*Interpreter).typeCmd,
+		},
+		{
+			Name:  CommandAST,
+			Usage: CommandAST + " [expression]",
+			Help:  "show the parsed tree of the expression",
+			Raw:   true,
+			Run:   (*Interpreter).astCmd,
+		},
+		{
+			Name:  CommandDot,
+			Usage: CommandDot + " [expression]",
+			Help:  "show the parsed tree of the expression as Graphviz DOT",
+			Raw:   true,
+			Run:   (*Interpreter).dotCmd,
+		},
+		{
+			Name:    CommandCallGraph,
+			Usage:   CommandCallGraph + " [" + string(parser.GraphDOT) + "|" + string(parser.GraphMermaid) + "]",
+			Help:    "show which functions call which, as Graphviz DOT or Mermaid",
+			MaxArgs: 1,
+			Run:     (*Interpreter).callGraphCmd,
+		},
+		{
+			Name:    CommandOutput,
+			Usage:   CommandOutput + " [" + outputText + "|" + outputLaTeX + "|" + outputMathML + "]",
+			Help:    "show results and definitions as text, LaTeX or MathML, or show the output mode",
+			MaxArgs: 1,
+			Replay:  true,
+			Run:     (*Interpreter).outputCmd,
+		},
+		{
+			Name:  CommandExplain,
+			Usage: CommandExplain + " [expression]",
+			Help:  "show each step of evaluating the expression",
+			Raw:   true,
+			Run:   (*Interpreter).explainCmd,
+		},
+		{
+			Name:    CommandTrace,
+			Usage:   CommandTrace + " [" + traceOn + "|" + traceOff + "]",
+			Help:    "turn tracing of function calls and branches on or off, or toggle it",
+			MaxArgs: 1,
+			Replay:  true,
+			Run:     (*Interpreter).traceCmd,
+		},
+		{
+			Name:   CommandBreak,
+			Usage:  CommandBreak + " [function [if condition]]",
+			Help:   "stop evaluating when the function is called and the condition holds, or list the breakpoints",
+			Raw:    true,
+			Replay: true,
+			Run:    (*Interpreter).breakCmd,
+		},
+		{
+			Name:    CommandUnbreak,
+			Usage:   CommandUnbreak + " [id]",
+			Help:    "remove the breakpoint, or all breakpoints",
+			MaxArgs: 1,
+			Replay:  true,
+			Run:     (*Interpreter).unbreakCmd,
+		},
+		{
+			Name:  CommandDebug,
+			Usage: CommandDebug + " [expression]",
+			Help:  "evaluate the expression in the debugger, stopping at the first function call",
+			Raw:   true,
+			Run:   (*Interpreter).debugCmd,
+		},
+	}
+}
+
+func (i *Interpreter) helpCmd(args []string) error {
+	if len(args) == 0 {
+		fmt.Println(i.help())
+		return nil
+	}
+	name := args[0]
+	if c, ok := i.commands[strings.ToLower(strings.TrimPrefix(name, commandPrefix))]; ok {
+		fmt.Printf("%s%s  %s\n", commandPrefix, c.Usage, c.Help)
+		return nil
+	}
+	v, ok := i.Environment.Snapshot()[name]
+	switch {
+	case ok && v.Function != nil:
+		fmt.Println(v.Function.Declaration())
+		if len(v.Function.Doc) > 0 {
+			fmt.Println(v.Function.Doc)
+		}
+	case ok:
+		fmt.Println(v.String())
+	default:
+		if b, ok := parser.LookupBuiltin(name); ok {
+			fmt.Println(b.String())
+			return nil
+		}
+		return fmt.Errorf("Unknown function or command `%s`", name)
+	}
+	return nil
+}
+
+func (i *Interpreter) help() string {
+	lines := []string{
+		"Syntax:",
+		"FuncDefs: `let [func name] [arg1] [arg2] ... = [expression]`",
+		"[expression without vars]",
+		"Names are made of letters and underscores",
+		"Unfinished statements, or lines ending in \\, continue on the next line",
+		"!! reruns the last statement, !n reruns statement n, !prefix reruns the last statement starting with prefix",
+		"The previous result is held in " + lastResult + " and " + lastResultShort + ", unless they are defined",
+		"Commands:",
+	}
+	for _, c := range i.commandList {
+		line := fmt.Sprintf("  %s%s  %s", commandPrefix, c.Usage, c.Help)
+		if len(c.Aliases) > 0 {
+			line += fmt.Sprintf(" (also %s%s)", commandPrefix, strings.Join(c.Aliases, ", "+commandPrefix))
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, "Builtins:")
+	for _, b := range parser.Builtins() {
+		lines = append(lines, "  "+b.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (i *Interpreter) quitCmd(args []string) error {
+	os.Exit(0)
+	return nil
+}
+
+func (i *Interpreter) envCmd(args []string) error {
+	if out := i.env(); len(out) > 0 {
+		fmt.Println(out)
+	}
+	return nil
+}
+
+// env lists the environment, with the inferred type of each function that type checks
+func (i *Interpreter) env() string {
+	vars := []string{}
+	ctx := i.Environment.Snapshot()
+	for _, v := range ctx {
+		line := v.String()
+		if v.Function != nil {
+			if t, err := ctx.Infer(v.Function); err == nil {
+				line += " : " + t.String()
+			}
+		}
+		vars = append(vars, line)
+	}
+	return strings.Join(vars, "\n")
+}
+
+func (i *Interpreter) clearCmd(args []string) error {
+	i.clear()
+	fmt.Println(successDone)
+	return nil
+}
+
+func (i *Interpreter) historyCmd(args []string) error {
+	if len(args) == 0 {
+		if out := i.getHistory(); len(out) > 0 {
+			fmt.Println(out)
+		}
+		return nil
+	}
+	switch strings.ToLower(args[0]) {
+	case historyClear:
+		if len(args) == 1 {
+			i.History = make([]string, 0)
+			fmt.Println(successDone)
+			return nil
+		}
+	case historySave:
+		if len(args) == 2 {
+			script := []string{}
+			for _, statement := range i.History {
+				if i.isReplayable(statement) {
+					script = append(script, statement)
+				}
+			}
+			if err := saveLines(args[1], script); err != nil {
+				return err
+			}
+			fmt.Println(successDone)
+			return nil
+		}
+	}
+	return fmt.Errorf("Syntax: %s%s [%s|%s filename]", commandPrefix, CommandHistory, historyClear, historySave)
+}
+
+// isReplayable returns whether the statement belongs in a saved session script: definitions,
+// expressions and the commands marked to be replayed
+func (i *Interpreter) isReplayable(input string) bool {
+	if isEmpty(input) {
+		return false
+	}
+	c, _, err := i.parseCommand(input)
+	if err != nil || c == nil {
+		return err == nil
+	}
+	return c.Replay
+}
+
+func (i *Interpreter) importCmd(args []string) error {
+	stmts, err := load(args[0])
+	if err != nil {
+		return err
+	}
+	dir := i.dir
+	i.dir = filepath.Dir(args[0])
+	defer func() { i.dir = dir }()
+	for n := 0; n < len(stmts); n++ {
+		if defs := parser.LeadingDefinitions(stmts[n:]); len(defs) > 0 {
+			// runs of definitions are defined in one update, so the environment is copied once
+			fns, err := i.DefineStatements(defs)
+			for _, f := range fns {
+				fmt.Println("OK", i.showFunction(f))
+			}
+			if err != nil {
+				fmt.Println(err)
+				n += len(fns)
+			} else {
+				n += len(defs) - 1
+			}
+			continue
+		}
+		i.doc = stmts[n].Doc
+		i.interpret(stmts[n].Source)
+	}
+	fmt.Println(successDone)
+	return nil
+}
+
+func (i *Interpreter) exportCmd(args []string) error {
+	if err := save(args[0], i.Environment.Snapshot(), i.Imports()); err != nil {
+		return err
+	}
+	fmt.Println(successDone)
+	return nil
+}
+
+func (i *Interpreter) setCmd(args []string) error {
+	fields := strings.Fields(args[0])
+	if len(fields) < 2 {
+		return fmt.Errorf("Syntax: %s%s [name] [expression]", commandPrefix, CommandSet)
+	}
+	name := fields[0]
+	if err := parser.ValidateIdentifier(name); err != nil {
+		return err
+	}
+	if i.Environment.Snapshot().IsBuiltin(name) {
+		return fmt.Errorf("Cannot redefine builtin function `%s`", name)
+	}
+	val, err := i.evalWith(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(args[0]), name)), false, false)
+	if err != nil {
+		return err
+	}
+	i.Environment.Set(name, parser.FromValue(&val))
+	fmt.Println(val)
+	return nil
+}
+
+func (i *Interpreter) overrideCmd(args []string) error {
+	f, err := i.Override(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println("OK", f.String())
+	return nil
+}
+
+func (i *Interpreter) typeCmd(args []string) error {
+	t, err := i.typeOf(args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Println(t)
+	return nil
+}
+
+func (i *Interpreter) dotCmd(args []string) error {
+	a, err := parser.Parse(strings.TrimSpace(args[0]))
+	if err != nil {
+		return err
+	}
+	out, err := a.Root.Graph(parser.GraphDOT)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+func (i *Interpreter) callGraphCmd(args []string) error {
+	format := parser.GraphDOT
+	if len(args) > 0 {
+		format = parser.GraphFormat(strings.ToLower(args[0]))
+	}
+	out, err := i.Environment.Snapshot().CallGraph(format)
+	if err != nil {
+		return err
+	}
+	fmt.Println(out)
+	return nil
+}
+
+func (i *Interpreter) outputCmd(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Output is", i.outputMode())
+		return nil
+	}
+	switch mode := strings.ToLower(args[0]); mode {
+	case outputText, outputLaTeX, outputMathML:
+		i.output = mode
+		fmt.Println("Output is", mode)
+		return nil
+	}
+	return fmt.Errorf("Syntax: %s%s [%s|%s|%s]", commandPrefix, CommandOutput, outputText, outputLaTeX, outputMathML)
+}
+
+func (i *Interpreter) astCmd(args []string) error {
+	a, err := parser.Parse(strings.TrimSpace(args[0]))
+	if err != nil {
+		return err
+	}
+	fmt.Println(a.Root.Tree())
+	return nil
+}
+
+func (i *Interpreter) explainCmd(args []string) error {
+	steps, err := i.Explain(args[0])
+	for n, step := range steps {
+		fmt.Printf("[%d] %s\n", n, step.String())
+	}
+	return err
+}
+
+func (i *Interpreter) traceCmd(args []string) error {
+	on := i.Hook == nil
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case traceOn:
+			on = true
+		case traceOff:
+			on = false
+		default:
+			return fmt.Errorf("Syntax: %s%s [%s|%s]", commandPrefix, CommandTrace, traceOn, traceOff)
+		}
+	}
+	if on {
+		i.Hook = parser.NewTracer(os.Stdout)
+		fmt.Println("Tracing on")
+	} else {
+		i.Hook = nil
+		fmt.Println("Tracing off")
+	}
+	return nil
+}
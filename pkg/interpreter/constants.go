@@ -1,8 +1,44 @@
 package interpreter
 
 const (
-	linePrompt  = ">"
-	successDone = "Done"
+	// Version is the version of the interpreter
+	Version = "0.1.0"
+
+	linePrompt         = ">"
+	continuationPrompt = ".."
+	successDone        = "Done"
+
+	historyFile = ".interpreter_history"
+	maxHistory  = 1000
+
+	// historyPrefix starts a reference to a previous statement, as in !!, !n or !prefix
+	historyPrefix = "!"
+	historyClear  = "clear"
+	historySave   = "save"
+
+	traceOn  = "on"
+	traceOff = "off"
+
+	// outputText, outputLaTeX and outputMathML are how results and definitions are shown
+	outputText   = "text"
+	outputLaTeX  = "latex"
+	outputMathML = "mathml"
+
+	debugPrompt = "debug>"
+
+	// lastResult and lastResultShort are the variables holding the previous result
+	lastResult      = "last"
+	lastResultShort = "_"
+
+	// snapshotMagic starts a snapshot file written by the save command
+	snapshotMagic   = "FNSNAP"
+	snapshotVersion = 2
+
+	// searchPathEnv is the environment variable listing the directories searched for modules
+	searchPathEnv = "INTERPRETER_PATH"
+
+	// commandPrefix starts a command, as in :help
+	commandPrefix = ":"
 
 	// CommandQuit is the quit command
 	CommandQuit = "quit"
@@ -24,21 +60,32 @@ const (
 	CommandImport = "import"
 	// CommandExport is the export command
 	CommandExport = "export"
-)
-
-var (
-
-	// Commands are all of the commands
-	Commands = []string{
-		CommandQuit,
-		CommandExit,
-		CommandEnv,
-		CommandContext,
-		CommandClear,
-		CommandHistory,
-		CommandHelp,
-		CommandSyntax,
-		CommandImport,
-		CommandExport,
-	}
+	// CommandOverride is the override command
+	CommandOverride = "override"
+	// CommandType is the type command
+	CommandType = "type"
+	// CommandAST is the ast command
+	CommandAST = "ast"
+	// CommandExplain is the explain command
+	CommandExplain = "explain"
+	// CommandTrace is the trace command
+	CommandTrace = "trace"
+	// CommandBreak is the break command
+	CommandBreak = "break"
+	// CommandUnbreak is the unbreak command
+	CommandUnbreak = "unbreak"
+	// CommandDebug is the debug command
+	CommandDebug = "debug"
+	// CommandDot is the dot command
+	CommandDot = "dot"
+	// CommandCallGraph is the callgraph command
+	CommandCallGraph = "callgraph"
+	// CommandSet is the set command
+	CommandSet = "set"
+	// CommandSave is the save command
+	CommandSave = "save"
+	// CommandRestore is the restore command
+	CommandRestore = "restore"
+	// CommandOutput is the output command
+	CommandOutput = "output"
 )
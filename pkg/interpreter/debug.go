@@ -0,0 +1,178 @@
+package interpreter
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mat285/interpreter/pkg/parser"
+)
+
+// debugCommand is a command accepted while the debugger is stopped
+type debugCommand struct {
+	names []string
+	usage string
+	help  string
+	run   func(i *Interpreter, s *parser.Stop, arg string) (parser.Action, bool)
+}
+
+func debugCommands() []*debugCommand {
+	return []*debugCommand{
+		{names: []string{"step", "s"}, usage: "step", help: "stop at the next function call", run: resume(parser.StepIn)},
+		{names: []string{"next", "n"}, usage: "next", help: "stop at the next function call outside of this one", run: resume(parser.StepOver)},
+		{names: []string{"out", "o"}, usage: "out", help: "stop at the next function call after this one returns", run: resume(parser.StepOut)},
+		{names: []string{"continue", "c"}, usage: "continue", help: "run to the next breakpoint", run: resume(parser.Continue)},
+		{names: []string{"abort", "q"}, usage: "abort", help: "stop evaluating", run: resume(parser.Abort)},
+		{names: []string{"stack", "bt"}, usage: "stack", help: "show the calls in progress", run: (*Interpreter).debugStack},
+		{names: []string{"locals", "l"}, usage: "locals", help: "show the inputs of the current call", run: (*Interpreter).debugLocals},
+		{names: []string{"print", "p"}, usage: "print [expression]", help: "evaluate the expression in the current call", run: (*Interpreter).debugPrint},
+		{names: []string{"help", "h"}, usage: "help", help: "show the debugger commands", run: (*Interpreter).debugHelp},
+	}
+}
+
+func resume(action parser.Action) func(i *Interpreter, s *parser.Stop, arg string) (parser.Action, bool) {
+	return func(i *Interpreter, s *parser.Stop, arg string) (parser.Action, bool) {
+		return action, true
+	}
+}
+
+// stopped reads debugger commands until one resumes the evaluation
+func (i *Interpreter) stopped(s *parser.Stop) parser.Action {
+	if s.Breakpoint != nil {
+		fmt.Printf("Breakpoint %s hit at %s\n", s.Breakpoint.String(), s.Frame.String())
+	} else {
+		fmt.Printf("Stopped at %s\n", s.Frame.String())
+	}
+	if i.editor == nil {
+		return parser.Continue
+	}
+	for {
+		input, err := i.editor.readLine(debugPrompt)
+		if err == io.EOF {
+			return parser.Abort
+		} else if err == errInterrupted {
+			continue
+		} else if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		input = strings.TrimSpace(input)
+		if len(input) == 0 {
+			continue
+		}
+		name, arg := input, ""
+		if end := strings.IndexFunc(input, unicode.IsSpace); end >= 0 {
+			name, arg = input[:end], strings.TrimSpace(input[end:])
+		}
+		c := findDebugCommand(strings.ToLower(name))
+		if c == nil {
+			fmt.Printf("Unknown debugger command `%s`. Use help to list commands\n", name)
+			continue
+		}
+		if action, ok := c.run(i, s, arg); ok {
+			return action
+		}
+	}
+}
+
+func findDebugCommand(name string) *debugCommand {
+	for _, c := range debugCommands() {
+		for _, n := range c.names {
+			if n == name {
+				return c
+			}
+		}
+	}
+	return nil
+}
+
+func (i *Interpreter) debugStack(s *parser.Stop, arg string) (parser.Action, bool) {
+	for n := len(s.Stack) - 1; n >= 0; n-- {
+		fmt.Printf("[%d] %s\n", n, s.Stack[n].String())
+	}
+	return parser.Continue, false
+}
+
+func (i *Interpreter) debugLocals(s *parser.Stop, arg string) (parser.Action, bool) {
+	names := make([]string, 0, len(s.Frame.Locals))
+	for name := range s.Frame.Locals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("%s = %s\n", name, s.Frame.Locals[name].String())
+	}
+	return parser.Continue, false
+}
+
+func (i *Interpreter) debugPrint(s *parser.Stop, arg string) (parser.Action, bool) {
+	val, err := i.debugger.EvalFrame(s.Frame, arg)
+	if err != nil {
+		fmt.Println(err)
+	} else {
+		fmt.Println(val)
+	}
+	return parser.Continue, false
+}
+
+func (i *Interpreter) debugHelp(s *parser.Stop, arg string) (parser.Action, bool) {
+	for _, c := range debugCommands() {
+		fmt.Printf("  %s  %s (also %s)\n", c.usage, c.help, strings.Join(c.names[1:], ", "))
+	}
+	return parser.Continue, false
+}
+
+func (i *Interpreter) breakCmd(args []string) error {
+	src := strings.TrimSpace(args[0])
+	if len(src) == 0 {
+		for _, b := range i.debugger.Breakpoints() {
+			fmt.Println(b.String())
+		}
+		return nil
+	}
+	function, condition := src, ""
+	if end := strings.IndexFunc(src, unicode.IsSpace); end >= 0 {
+		function = src[:end]
+		rest := strings.TrimSpace(src[end:])
+		condition = strings.TrimPrefix(rest, parser.KeywordIf)
+		if condition == rest || len(strings.TrimSpace(condition)) == 0 || !unicode.IsSpace([]rune(condition)[0]) {
+			return fmt.Errorf("Syntax: %s%s [function [%s condition]]", commandPrefix, CommandBreak, parser.KeywordIf)
+		}
+	}
+	b, err := i.debugger.Break(function, condition)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Breakpoint", b.String())
+	return nil
+}
+
+func (i *Interpreter) unbreakCmd(args []string) error {
+	if len(args) == 0 {
+		i.debugger.ClearBreakpoints()
+		fmt.Println(successDone)
+		return nil
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("Invalid breakpoint `%s`", args[0])
+	}
+	if err := i.debugger.Delete(id); err != nil {
+		return err
+	}
+	fmt.Println(successDone)
+	return nil
+}
+
+func (i *Interpreter) debugCmd(args []string) error {
+	val, err := i.evalWith(args[0], true, true)
+	if err != nil {
+		return err
+	}
+	i.setLast(val)
+	fmt.Println(val)
+	return nil
+}
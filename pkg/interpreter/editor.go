@@ -0,0 +1,390 @@
+package interpreter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mat285/interpreter/pkg/parser"
+)
+
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlG     = 7
+	keyBackspace = 8
+	keyTab       = 9
+	keyLineFeed  = 10
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlR     = 18
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// keys decoded from escape sequences
+const (
+	keyUp = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDeleteForward
+	keyUnknown
+)
+
+// errInterrupted is returned when the line is abandoned with ctrl-c
+var errInterrupted = errors.New("Interrupted")
+
+// lineEditor reads lines of input. When reading from a terminal it supports cursor movement,
+// history navigation and search, and tab completion
+type lineEditor struct {
+	fd  int
+	in  *bufio.Reader
+	out io.Writer
+
+	history []string
+	file    string
+
+	// complete returns the candidates that complete the word
+	complete func(word string) []string
+}
+
+func newLineEditor(in *os.File, out io.Writer) *lineEditor {
+	return &lineEditor{
+		fd:  int(in.Fd()),
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+// loadHistory loads the history from the file, and appends new lines to it from then on
+func (l *lineEditor) loadHistory(file string) error {
+	l.file = file
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(strings.TrimSpace(line)) > 0 {
+			l.history = append(l.history, line)
+		}
+	}
+	if len(l.history) > maxHistory {
+		l.history = l.history[len(l.history)-maxHistory:]
+		return ioutil.WriteFile(file, []byte(strings.Join(l.history, "\n")+"\n"), 0600)
+	}
+	return nil
+}
+
+// addHistory adds the line to the history when reading from a terminal
+func (l *lineEditor) addHistory(line string) {
+	if !isTerminal(l.fd) || len(strings.TrimSpace(line)) == 0 || strings.ContainsRune(line, '\n') {
+		return
+	}
+	if len(l.history) > 0 && l.history[len(l.history)-1] == line {
+		return
+	}
+	l.history = append(l.history, line)
+	if len(l.file) == 0 {
+		return
+	}
+	f, err := os.OpenFile(l.file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// readLine reads a line, without the trailing newline
+func (l *lineEditor) readLine(prompt string) (string, error) {
+	if isTerminal(l.fd) {
+		t, err := makeRaw(l.fd)
+		if err == nil {
+			defer t.restore()
+			return l.edit(prompt)
+		}
+	}
+	fmt.Fprint(l.out, prompt)
+	line, err := l.in.ReadString('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (l *lineEditor) readKey() (rune, error) {
+	r, _, err := l.in.ReadRune()
+	if err != nil || r != keyEscape {
+		return r, err
+	}
+	next, _, err := l.in.ReadRune()
+	if err != nil {
+		return r, err
+	}
+	if next != '[' && next != 'O' {
+		return keyUnknown, nil
+	}
+	seq := []rune{}
+	for {
+		c, _, err := l.in.ReadRune()
+		if err != nil {
+			return r, err
+		}
+		seq = append(seq, c)
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+	switch string(seq) {
+	case "A":
+		return keyUp, nil
+	case "B":
+		return keyDown, nil
+	case "C":
+		return keyRight, nil
+	case "D":
+		return keyLeft, nil
+	case "H", "1~", "7~":
+		return keyHome, nil
+	case "F", "4~", "8~":
+		return keyEnd, nil
+	case "3~":
+		return keyDeleteForward, nil
+	}
+	return keyUnknown, nil
+}
+
+func (l *lineEditor) refresh(prompt string, buf []rune, pos int) {
+	fmt.Fprintf(l.out, "\r%s%s\x1b[K\r", prompt, string(buf))
+	if n := len([]rune(prompt)) + pos; n > 0 {
+		fmt.Fprintf(l.out, "\x1b[%dC", n)
+	}
+}
+
+func (l *lineEditor) edit(prompt string) (string, error) {
+	buf := []rune{}
+	pos := 0
+	// hist is the index of the history entry being shown, with len(history) being the new line
+	hist := len(l.history)
+	saved := []rune{}
+
+	show := func(line []rune) {
+		buf = append([]rune{}, line...)
+		pos = len(buf)
+	}
+
+	l.refresh(prompt, buf, pos)
+	for {
+		key, err := l.readKey()
+		if err != nil {
+			return "", err
+		}
+		switch key {
+		case keyEnter, keyLineFeed:
+			fmt.Fprint(l.out, "\r\n")
+			return string(buf), nil
+		case keyCtrlC:
+			fmt.Fprint(l.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(buf) == 0 {
+				fmt.Fprint(l.out, "\r\n")
+				return "", io.EOF
+			}
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyDeleteForward:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case keyBackspace, keyDelete:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case keyCtrlA, keyHome:
+			pos = 0
+		case keyCtrlE, keyEnd:
+			pos = len(buf)
+		case keyCtrlB, keyLeft:
+			if pos > 0 {
+				pos--
+			}
+		case keyCtrlF, keyRight:
+			if pos < len(buf) {
+				pos++
+			}
+		case keyCtrlK:
+			buf = buf[:pos]
+		case keyCtrlU:
+			buf = buf[pos:]
+			pos = 0
+		case keyCtrlW:
+			start := pos
+			for start > 0 && unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case keyCtrlL:
+			fmt.Fprint(l.out, "\x1b[H\x1b[2J")
+		case keyCtrlP, keyUp:
+			if hist > 0 {
+				if hist == len(l.history) {
+					saved = buf
+				}
+				hist--
+				show([]rune(l.history[hist]))
+			}
+		case keyCtrlN, keyDown:
+			if hist < len(l.history) {
+				hist++
+				if hist == len(l.history) {
+					show(saved)
+				} else {
+					show([]rune(l.history[hist]))
+				}
+			}
+		case keyCtrlR:
+			line, submit, err := l.search(buf)
+			if err != nil {
+				return "", err
+			}
+			show(line)
+			if submit {
+				l.refresh(prompt, buf, pos)
+				fmt.Fprint(l.out, "\r\n")
+				return string(buf), nil
+			}
+		case keyTab:
+			buf, pos = l.completeWord(buf, pos)
+		case keyUnknown, keyEscape:
+		default:
+			if unicode.IsPrint(key) {
+				buf = append(buf[:pos], append([]rune{key}, buf[pos:]...)...)
+				pos++
+			}
+		}
+		l.refresh(prompt, buf, pos)
+	}
+}
+
+// search runs a reverse incremental search of the history, returning the chosen line and
+// whether it should be submitted
+func (l *lineEditor) search(original []rune) ([]rune, bool, error) {
+	query := []rune{}
+	match := len(l.history)
+	find := func(from int) {
+		for i := from; i >= 0; i-- {
+			if i < len(l.history) && strings.Contains(l.history[i], string(query)) {
+				match = i
+				return
+			}
+		}
+	}
+	for {
+		line := ""
+		if match < len(l.history) {
+			line = l.history[match]
+		}
+		l.refresh(fmt.Sprintf("(reverse-i-search)`%s': ", string(query)), []rune(line), len([]rune(line)))
+
+		key, err := l.readKey()
+		if err != nil {
+			return nil, false, err
+		}
+		switch key {
+		case keyEnter, keyLineFeed:
+			return []rune(line), true, nil
+		case keyCtrlG, keyCtrlC:
+			return original, false, nil
+		case keyCtrlR:
+			find(match - 1)
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				find(len(l.history) - 1)
+			}
+		default:
+			if key > 0 && unicode.IsPrint(key) {
+				query = append(query, key)
+				find(match)
+				continue
+			}
+			if match < len(l.history) {
+				return []rune(line), false, nil
+			}
+			return original, false, nil
+		}
+	}
+}
+
+// completeWord completes the word before the cursor
+func (l *lineEditor) completeWord(buf []rune, pos int) ([]rune, int) {
+	if l.complete == nil {
+		return buf, pos
+	}
+	start := pos
+	for start > 0 && parser.IsIdentifierRune(buf[start-1]) {
+		start--
+	}
+	word := string(buf[start:pos])
+	candidates := l.complete(word)
+	if len(candidates) == 0 {
+		fmt.Fprint(l.out, "\a")
+		return buf, pos
+	}
+	prefix := candidates[0]
+	for _, c := range candidates[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	if len(candidates) == 1 || len(prefix) > len(word) {
+		insert := []rune(prefix[len(word):])
+		buf = append(buf[:pos], append(insert, buf[pos:]...)...)
+		return buf, pos + len(insert)
+	}
+	fmt.Fprintf(l.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+	return buf, pos
+}
+
+// completions returns the sorted unique words with the prefix
+func completions(prefix string, words ...[]string) []string {
+	seen := map[string]bool{}
+	ret := []string{}
+	for _, ws := range words {
+		for _, w := range ws {
+			if strings.HasPrefix(w, prefix) && !seen[w] {
+				seen[w] = true
+				ret = append(ret, w)
+			}
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
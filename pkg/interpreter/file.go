@@ -1,21 +1,63 @@
 package interpreter
 
 import (
+	"fmt"
 	"io/ioutil"
+	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/mat285/interpreter/pkg/parser"
 )
 
-func save(file string, ctx parser.Context) error {
-	data := []byte(ctx.Source())
+func save(file string, ctx parser.Context, imports []string) error {
+	data := []byte(script(ctx, imports, time.Now()))
 	return ioutil.WriteFile(file, data, 0777)
 }
 
-func load(file string) ([]string, error) {
-	data, err := ioutil.ReadFile(file)
+// script returns a script that runs the imports, sets the variables of the context and defines
+// its functions, starting with a header comment. Functions replacing a builtin are defined with
+// the override command
+func script(ctx parser.Context, imports []string, now time.Time) string {
+	lines := []string{fmt.Sprintf("%s Exported by interpreter %s at %s", parser.CommentLine, Version, now.Format(time.RFC3339))}
+	lines = append(lines, imports...)
+	names := []string{}
+	for name, v := range ctx {
+		if v.Value != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("%s%s %s %d", commandPrefix, CommandSet, name, *ctx[name].Value))
+	}
+	if fns := ctx.Functions(); len(fns) > 0 {
+		lines = append(lines, "")
+		for _, f := range fns {
+			if len(f.Doc) > 0 {
+				lines = append(lines, parser.DocComment(f.Doc))
+			}
+			decl := f.Declaration()
+			if ctx.IsBuiltin(*f.Name) {
+				decl = commandPrefix + CommandOverride + " " + decl
+			}
+			lines = append(lines, decl)
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func load(file string) ([]parser.Statement, error) {
+	f, err := os.Open(file)
 	if err != nil {
 		return nil, err
 	}
-	return strings.Split(string(data), "\n"), nil
+	defer f.Close()
+	return parser.ReadStatements(f)
+}
+
+func saveLines(file string, lines []string) error {
+	data := []byte(strings.Join(lines, "\n") + "\n")
+	return ioutil.WriteFile(file, data, 0777)
 }
@@ -1,74 +1,37 @@
 package interpreter
 
 import (
-	"bufio"
-	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
-)
 
-func sanitize(input string) string {
-	return strings.TrimSpace(strings.ToLower(input))
-}
+	"github.com/mat285/interpreter/pkg/parser"
+)
 
 func isFuncDef(input string) bool {
-	return strings.HasPrefix(sanitize(input), "let ")
+	return parser.IsDefinition(input)
 }
 
 func isEmpty(input string) bool {
-	return len(sanitize(input)) == 0
-}
-
-func isQuit(input string) bool {
-	str := sanitize(input)
-	return str == CommandQuit || str == CommandExit
-}
-
-func isEnv(input string) bool {
-	str := sanitize(input)
-	return str == CommandEnv || str == CommandContext
-}
-
-func isClear(input string) bool {
-	str := sanitize(input)
-	return str == CommandClear
+	return len(strings.TrimSpace(input)) == 0
 }
 
-func isHistory(input string) bool {
-	str := sanitize(input)
-	return str == CommandHistory
+func isComment(input string) bool {
+	return !isEmpty(input) && isEmpty(parser.StripComments(input))
 }
 
-func isHelp(input string) bool {
-	str := sanitize(input)
-	return str == CommandHelp || str == CommandSyntax
-}
-
-func isImport(input string) bool {
-	str := sanitize(input) + " "
-	return strings.HasPrefix(str, CommandImport+" ")
-}
-
-func isExport(input string) bool {
-	str := sanitize(input) + " "
-	return strings.HasPrefix(str, CommandExport+" ")
-}
-
-func getFileFromCommand(input string) (string, error) {
-	input = sanitize(input)
-	parts := strings.SplitN(input, " ", 2)
-	if len(parts) != 2 {
-		return "", fmt.Errorf("Missing filename for %s. Syntax: %s [filename]", parts[0], parts[0])
+// isIncomplete returns whether the input is an unfinished statement that continues on the next line
+func isIncomplete(input string) bool {
+	if name, _, ok := splitCommand(input); ok && name != CommandOverride {
+		return false
 	}
-	return parts[1], nil
-}
-
-func getHelpString() string {
-	return "Syntax:\nFuncDefs: `let [func name] [arg1] [arg2] ... = [expression]\n[expression without vars]\nimport/export [filename]\nOther: help, exit, quit, history, clear"
+	return parser.Incomplete(input)
 }
 
-func flush(reader *bufio.Reader) {
-	var i int
-	for i = 0; i < reader.Buffered(); i++ {
-		reader.ReadByte()
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
 	}
+	return filepath.Join(home, historyFile)
 }
@@ -1,9 +1,12 @@
 package interpreter
 
 import (
-	"bufio"
+	"context"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/mat285/interpreter/pkg/parser"
@@ -11,28 +14,105 @@ import (
 
 // Interpreter is a commandline interpreter
 type Interpreter struct {
-	Context parser.Context
+	*parser.Runtime
 	History []string
+
+	commands    map[string]*Command
+	commandList []*Command
+
+	editor   *lineEditor
+	debugger *parser.Debugger
+	// doc is the text of the comments since the last statement, the doc of a following definition
+	doc string
+	// output is the output mode, one of outputText, outputLaTeX or outputMathML
+	output string
+	// dir is the directory of the file being imported, which imports in the file are relative to
+	dir string
+	// last is the previous result, if there is one. It is not in the environment, so that it
+	// never replaces a definition
+	last *parser.Value
 }
 
 // New creates a new interpreter
 func New() *Interpreter {
-	return &Interpreter{
-		Context: parser.NewContext(),
-		History: make([]string, 0),
+	i := &Interpreter{
+		Runtime:  parser.NewRuntime(),
+		History:  make([]string, 0),
+		commands: make(map[string]*Command),
+	}
+	i.SearchPath = filepath.SplitList(os.Getenv(searchPathEnv))
+	i.debugger = parser.NewDebugger(i.Runtime, i.stopped)
+	for _, c := range defaultCommands() {
+		i.RegisterCommand(c)
 	}
+	return i
 }
 
 // Start starts the interpreter
 func (i *Interpreter) Start() {
-	fmt.Println("Started functional interpreter with new environment. Use quit or exit to end session. Use help for more information")
+	fmt.Println("Started functional interpreter with new environment. Use :quit or :exit to end session. Use :help for more information")
+	editor := newLineEditor(os.Stdin, os.Stdout)
+	editor.complete = i.complete
+	i.editor = editor
+	if file := historyPath(); len(file) > 0 {
+		if err := editor.loadHistory(file); err != nil {
+			fmt.Println(err)
+		}
+	}
 	for {
-		i.run()
+		i.run(editor)
 	}
 }
 
 func (i *Interpreter) addToHistory(input string) {
-	i.History = append(i.History, sanitize(input))
+	i.History = append(i.History, strings.TrimSpace(input))
+}
+
+// expandHistory replaces a reference to a previous statement with that statement
+func (i *Interpreter) expandHistory(input string) (string, error) {
+	str := strings.TrimSpace(input)
+	if !strings.HasPrefix(str, historyPrefix) {
+		return input, nil
+	}
+	ref := strings.TrimPrefix(str, historyPrefix)
+	if len(i.History) == 0 {
+		return "", fmt.Errorf("No history to rerun")
+	}
+	if ref == historyPrefix {
+		return i.History[len(i.History)-1], nil
+	}
+	if n, err := strconv.Atoi(ref); err == nil {
+		if n < 0 || n >= len(i.History) {
+			return "", fmt.Errorf("No history entry [%d]", n)
+		}
+		return i.History[n], nil
+	}
+	for j := len(i.History) - 1; j >= 0; j-- {
+		if len(ref) > 0 && strings.HasPrefix(i.History[j], ref) {
+			return i.History[j], nil
+		}
+	}
+	return "", fmt.Errorf("No history entry starting with `%s`", ref)
+}
+
+// setLast stores the previous result
+func (i *Interpreter) setLast(val parser.Value) {
+	i.last = &val
+}
+
+// vars returns a snapshot of the environment with the previous result as the last result
+// variables, unless the environment defines them
+func (i *Interpreter) vars() parser.Context {
+	global := i.Environment.Snapshot()
+	if i.last == nil {
+		return global
+	}
+	results := parser.NewContext()
+	for _, name := range []string{lastResult, lastResultShort} {
+		v := *i.last
+		results[name] = parser.FromValue(&v)
+	}
+	return parser.StitchContext(global, results)
 }
 
 func (i *Interpreter) getHistory() string {
@@ -44,124 +124,185 @@ func (i *Interpreter) getHistory() string {
 	return strings.Join(hs, "\n")
 }
 
-func (i *Interpreter) clear() {
-	i.Context = parser.NewContext()
-}
-
-func (i *Interpreter) env() string {
-	vars := []string{}
-	for _, v := range i.Context {
-		vars = append(vars, v.String())
+func (i *Interpreter) complete(word string) []string {
+	names := []string{}
+	for name := range i.Environment.Snapshot() {
+		names = append(names, name)
+	}
+	for _, b := range parser.Builtins() {
+		names = append(names, b.Name)
 	}
-	return strings.Join(vars, "\n")
+	return completions(word, i.commandNames(), parser.Keywords, names)
 }
 
-func (i *Interpreter) mapFunc(f *parser.Function) error {
-	if f.Name == nil {
-		return fmt.Errorf("Cannot map anonymous function")
-	}
-	i.Context[*f.Name] = parser.FromFunc(f)
-	return nil
+// eval type checks and evaluates the input, under the debugger if there are breakpoints
+func (i *Interpreter) eval(input string) (parser.Value, error) {
+	return i.evalWith(input, len(i.debugger.Breakpoints()) > 0, false)
 }
 
-func (i *Interpreter) importCmd(input string) error {
-	file, err := getFileFromCommand(input)
+// evalWith type checks and evaluates the input with the previous result, under the debugger
+// if debug is set. The tree that is type checked is the one evaluated
+func (i *Interpreter) evalWith(input string, debug, step bool) (parser.Value, error) {
+	a, err := parser.Parse(strings.TrimSpace(input))
 	if err != nil {
-		return err
+		return -1, err
 	}
-	cmds, err := load(file)
-	if err != nil {
-		return err
+	vars := i.vars()
+	if _, err := vars.InferExpression(a.Root); err != nil {
+		return -1, err
 	}
-	for _, cmd := range cmds {
-		i.interpret(cmd)
+	if debug {
+		return i.debugger.EvalTree(context.Background(), a, vars, step)
 	}
-	return nil
+	return i.EvalTree(context.Background(), a, vars)
 }
 
-func (i *Interpreter) exportCmd(input string) error {
-	file, err := getFileFromCommand(input)
+// typeOf infers the type of the input with the previous result
+func (i *Interpreter) typeOf(input string) (string, error) {
+	a, err := parser.Parse(strings.TrimSpace(input))
 	if err != nil {
-		return err
+		return "", err
 	}
-	return save(file, i.Context)
+	t, err := i.vars().InferExpression(a.Root)
+	if err != nil {
+		return "", err
+	}
+	return t.String(), nil
+}
+
+func (i *Interpreter) clear() {
+	i.Runtime.Clear()
+	i.last = nil
 }
 
-func (i *Interpreter) run() {
+func (i *Interpreter) run(editor *lineEditor) {
 	defer func() {
 		err := recover()
 		fmt.Println(err)
 	}()
 
 	for {
-		reader := bufio.NewReader(os.Stdin)
-		flush(reader)
-		fmt.Print(linePrompt)
-		input, err := reader.ReadString('\n')
+		input, err := i.readStatement(editor)
+		if err == io.EOF {
+			os.Exit(0)
+		} else if err == errInterrupted {
+			continue
+		} else if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		expanded, err := i.expandHistory(input)
 		if err != nil {
 			fmt.Println(err)
 			continue
+		} else if expanded != input {
+			fmt.Println(expanded)
+			input = expanded
 		}
+		editor.addHistory(input)
 		i.addToHistory(input)
 		i.interpret(input)
 	}
 }
 
+// readStatement reads lines until they form a complete statement. An empty line ends the statement early
+func (i *Interpreter) readStatement(editor *lineEditor) (string, error) {
+	input, err := editor.readLine(linePrompt)
+	if err != nil {
+		return "", err
+	}
+	for isIncomplete(input) {
+		line, err := editor.readLine(continuationPrompt)
+		if err == io.EOF || (err == nil && isEmpty(line)) {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		input = parser.JoinLines(input, line)
+	}
+	return input, nil
+}
+
 func (i *Interpreter) interpret(input string) {
 	if isEmpty(input) {
 		return
-	} else if isHelp(input) {
-		fmt.Println(getHelpString())
-	} else if isQuit(input) {
-		os.Exit(0)
-	} else if isHistory(input) {
-		fmt.Println(i.getHistory())
-	} else if isClear(input) {
-		i.clear()
-		fmt.Println(successDone)
-	} else if isImport(input) {
-		err := i.importCmd(input)
+	}
+	if isComment(input) {
+		i.doc = strings.TrimSpace(i.doc + "\n" + strings.Join(parser.Comments(input), "\n"))
+		return
+	}
+	doc := i.doc
+	i.doc = ""
+	c, args, err := i.parseCommand(input)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if c != nil {
+		err = c.Run(i, args)
 		if err != nil {
 			fmt.Println(err)
-			return
 		}
-		fmt.Println(successDone)
-	} else if isExport(input) {
-		err := i.exportCmd(input)
+	} else if parser.IsModuleDeclaration(input) {
+		return
+	} else if parser.IsImport(input) {
+		m, err := i.Import(input, i.dir)
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
-		fmt.Println(successDone)
-	} else if isEnv(input) {
-		out := i.env()
-		if len(out) > 0 {
-			fmt.Println(out)
-		}
+		fmt.Printf("OK module %s: %s\n", m.Name, strings.Join(m.Exports, ", "))
 	} else if isFuncDef(input) {
-		f, err := parser.ParseFunction(input, i.Context)
+		f, err := i.DefineStatement(parser.Statement{Source: input, Doc: doc})
 		if err != nil {
 			fmt.Println(err)
 			return
 		}
-		err = i.mapFunc(f)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		fmt.Println("OK", f.String())
+		fmt.Println("OK", i.showFunction(f))
 	} else {
-		input = strings.TrimSpace(input)
-		a, err := parser.Parse(input)
+		val, err := i.eval(input)
 		if err != nil {
 			fmt.Println(err)
+			if c, ok := i.commands[strings.ToLower(strings.TrimSpace(input))]; ok {
+				fmt.Printf("Use %s%s to run the %s command\n", commandPrefix, c.Name, c.Name)
+			}
 			return
 		}
-		val, err := a.EvaluateFull(i.Context)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
-		fmt.Println(val)
+		i.setLast(val)
+		fmt.Println(i.showResult(input, val))
+	}
+}
+
+func (i *Interpreter) outputMode() string {
+	if len(i.output) == 0 {
+		return outputText
+	}
+	return i.output
+}
+
+// showFunction returns the definition in the output mode
+func (i *Interpreter) showFunction(f *parser.Function) string {
+	switch i.outputMode() {
+	case outputLaTeX:
+		return f.LaTeX()
+	case outputMathML:
+		return f.MathML()
+	}
+	return f.String()
+}
+
+// showResult returns the result in the output mode. LaTeX and MathML show the expression equal to its value
+func (i *Interpreter) showResult(input string, val parser.Value) string {
+	if i.outputMode() == outputText {
+		return fmt.Sprint(val)
+	}
+	exp := &parser.Expression{Val: &val}
+	if a, err := parser.Parse(strings.TrimSpace(input)); err == nil && a.Root.Val == nil {
+		op := parser.Equal
+		exp = &parser.Expression{Op: &op, Left: a.Root, Right: exp}
+	}
+	if i.outputMode() == outputLaTeX {
+		return exp.LaTeX()
 	}
+	return exp.MathML()
 }
@@ -0,0 +1,128 @@
+package interpreter
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLastResult(t *testing.T) {
+	i := New()
+	i.interpret("3")
+	if val, err := i.eval("_ + last"); err != nil || val != 6 {
+		t.Fatalf("Expected 6, found %d %v", val, err)
+	}
+	if _, ok := i.Environment.Snapshot()[lastResult]; ok {
+		t.Fatalf("Expected the last result not to be in the environment")
+	}
+
+	i.interpret("let last x = x + 1")
+	i.interpret("3")
+	v, ok := i.Environment.Snapshot()[lastResult]
+	if !ok || v.Function == nil {
+		t.Fatalf("Expected the function `last` to stay defined, found %v", v)
+	}
+	if val, err := i.eval("last(4) + _"); err != nil || val != 8 {
+		t.Fatalf("Expected 8, found %d %v", val, err)
+	}
+
+	i.clear()
+	if _, err := i.eval("_"); err == nil {
+		t.Fatalf("Expected no last result after clear")
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "session.fn")
+	i := New()
+	for _, input := range []string{
+		":override let abs x = x + 100",
+		"let g x = abs(x) * 2",
+		"// halves x",
+		"let half x = x / 2",
+		":set n g(1)",
+		"half(n)",
+	} {
+		i.interpret(input)
+	}
+	if err := i.exportCmd([]string{file}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), lastResult) || !strings.Contains(string(data), ":override let abs") {
+		t.Fatalf("Expected the override and no last result in the export, found\n%s", data)
+	}
+
+	j := New()
+	if err := j.importCmd([]string{file}); err != nil {
+		t.Fatal(err)
+	}
+	want, found := i.Environment.Snapshot(), j.Environment.Snapshot()
+	if len(want) != len(found) {
+		t.Fatalf("Expected %d definitions, found %d", len(want), len(found))
+	}
+	for name, v := range want {
+		if found[name].String() != v.String() {
+			t.Errorf("%s: expected %s, found %s", name, v.String(), found[name].String())
+		}
+	}
+	if want, found := i.Environment.Snapshot().Source(), j.Environment.Snapshot().Source(); want != found {
+		t.Errorf("Expected source\n%s\nfound\n%s", want, found)
+	}
+	if val, err := j.Call("g", 1); err != nil || val != 202 {
+		t.Fatalf("Expected 202, found %d %v", val, err)
+	}
+}
+
+func TestSavedHistoryIsReplayable(t *testing.T) {
+	dir := t.TempDir()
+	i := New()
+	for _, input := range []string{
+		"let f x = x + 1",
+		"f(1)",
+		":set n f(2)",
+		":export " + filepath.Join(dir, "out.fn"),
+		":save " + filepath.Join(dir, "out.snap"),
+		":restore " + filepath.Join(dir, "out.snap"),
+		":debug f(1)",
+		":clear",
+		":env",
+		":output latex",
+		"",
+	} {
+		i.addToHistory(input)
+	}
+	file := filepath.Join(dir, "history.fn")
+	if err := i.historyCmd([]string{historySave, file}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "let f x = x + 1\nf(1)\n:set n f(2)\n:output latex\n"; string(data) != want {
+		t.Fatalf("Expected\n%s\nfound\n%s", want, data)
+	}
+}
+
+func TestCompleteWord(t *testing.T) {
+	i := New()
+	i.interpret("let sum_sq x y = x * x + y * y")
+	l := &lineEditor{out: ioutil.Discard, complete: i.complete}
+	for _, c := range []struct {
+		line, want string
+	}{
+		{line: "sum_s", want: "sum_sq"},
+		{line: "1 + sum_", want: "1 + sum_sq"},
+		{line: "(sum_s", want: "(sum_sq"},
+	} {
+		buf, pos := l.completeWord([]rune(c.line), len([]rune(c.line)))
+		if string(buf) != c.want || pos != len(buf) {
+			t.Errorf("Expected %s to complete to %s, found %s at %d", c.line, c.want, string(buf), pos)
+		}
+	}
+}
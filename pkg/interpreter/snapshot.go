@@ -0,0 +1,215 @@
+package interpreter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mat285/interpreter/pkg/parser"
+)
+
+// snapshot is the state of the interpreter written by the save command. The file starts with
+// snapshotMagic, the version as two bytes and the CRC-32 checksum of the rest as four bytes.
+// The rest is encoded like a binary runtime, with integers as varints and strings and the
+// runtime prefixed by their lengths
+type snapshot struct {
+	Runtime     []byte
+	History     []string
+	Trace       bool
+	Output      string
+	Breakpoints []snapshotBreakpoint
+}
+
+type snapshotBreakpoint struct {
+	Function  string
+	Condition string
+}
+
+const snapshotHeaderSize = len(snapshotMagic) + 2 + 4
+
+func (i *Interpreter) saveCmd(args []string) error {
+	data, err := i.snapshot()
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(args[0], data, 0666); err != nil {
+		return err
+	}
+	fmt.Println(successDone)
+	return nil
+}
+
+func (i *Interpreter) restoreCmd(args []string) error {
+	data, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+	if err := i.restore(data); err != nil {
+		return fmt.Errorf("Cannot restore `%s`. %v", args[0], err)
+	}
+	fmt.Println(successDone)
+	return nil
+}
+
+// snapshot encodes the environment, settings, history, tracing and breakpoints of the interpreter
+func (i *Interpreter) snapshot() ([]byte, error) {
+	runtime, err := i.Runtime.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	s := snapshot{Runtime: runtime, History: i.History, Trace: i.Hook != nil, Output: i.output}
+	for _, bp := range i.debugger.Breakpoints() {
+		s.Breakpoints = append(s.Breakpoints, snapshotBreakpoint{Function: bp.Function, Condition: bp.Condition})
+	}
+	payload := s.encode()
+	header := make([]byte, snapshotHeaderSize)
+	copy(header, snapshotMagic)
+	binary.BigEndian.PutUint16(header[len(snapshotMagic):], snapshotVersion)
+	binary.BigEndian.PutUint32(header[len(snapshotMagic)+2:], crc32.ChecksumIEEE(payload.Bytes()))
+	return append(header, payload.Bytes()...), nil
+}
+
+// restore replaces the state of the interpreter with the snapshot, leaving it unchanged if
+// the snapshot is not valid
+func (i *Interpreter) restore(data []byte) error {
+	if len(data) < snapshotHeaderSize || string(data[:len(snapshotMagic)]) != snapshotMagic {
+		return fmt.Errorf("The file is not a snapshot")
+	}
+	if v := binary.BigEndian.Uint16(data[len(snapshotMagic):]); v != snapshotVersion {
+		return fmt.Errorf("The snapshot has version %d, but this interpreter reads version %d", v, snapshotVersion)
+	}
+	payload := data[snapshotHeaderSize:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(data[len(snapshotMagic)+2:]) {
+		return fmt.Errorf("The snapshot is corrupted. Its checksum does not match")
+	}
+	s, err := decodeSnapshot(payload)
+	if err != nil {
+		return fmt.Errorf("The snapshot is corrupted. %v", err)
+	}
+	if err := i.Runtime.UnmarshalBinary(s.Runtime); err != nil {
+		return err
+	}
+	i.History = append([]string{}, s.History...)
+	if s.Trace {
+		i.Hook = parser.NewTracer(os.Stdout)
+	} else {
+		i.Hook = nil
+	}
+	i.output = s.Output
+	i.debugger.ClearBreakpoints()
+	for _, bp := range s.Breakpoints {
+		if _, err := i.debugger.Break(bp.Function, bp.Condition); err != nil {
+			fmt.Println(err)
+		}
+	}
+	return nil
+}
+
+func (s *snapshot) encode() *bytes.Buffer {
+	w := &snapshotWriter{}
+	w.bytes(s.Runtime)
+	w.uint(len(s.History))
+	for _, h := range s.History {
+		w.string(h)
+	}
+	w.bool(s.Trace)
+	w.string(s.Output)
+	w.uint(len(s.Breakpoints))
+	for _, bp := range s.Breakpoints {
+		w.string(bp.Function)
+		w.string(bp.Condition)
+	}
+	return &w.buf
+}
+
+func decodeSnapshot(data []byte) (*snapshot, error) {
+	rd := &snapshotReader{r: bytes.NewReader(data)}
+	s := &snapshot{Runtime: rd.bytes()}
+	for n := rd.count(); n > 0 && rd.err == nil; n-- {
+		s.History = append(s.History, rd.string())
+	}
+	s.Trace = rd.bool()
+	s.Output = rd.string()
+	for n := rd.count(); n > 0 && rd.err == nil; n-- {
+		s.Breakpoints = append(s.Breakpoints, snapshotBreakpoint{Function: rd.string(), Condition: rd.string()})
+	}
+	if rd.err == nil && rd.r.Len() > 0 {
+		rd.err = fmt.Errorf("%d unexpected bytes at the end", rd.r.Len())
+	}
+	return s, rd.err
+}
+
+// snapshotWriter writes integers as varints and strings with their lengths
+type snapshotWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *snapshotWriter) uint(v int) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], uint64(v))])
+}
+
+func (w *snapshotWriter) bool(v bool) {
+	if v {
+		w.uint(1)
+	} else {
+		w.uint(0)
+	}
+}
+
+func (w *snapshotWriter) bytes(b []byte) {
+	w.uint(len(b))
+	w.buf.Write(b)
+}
+
+func (w *snapshotWriter) string(s string) {
+	w.bytes([]byte(s))
+}
+
+// snapshotReader reads what snapshotWriter writes. The first error is kept and later reads return zero values
+type snapshotReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (rd *snapshotReader) uint() int {
+	if rd.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(rd.r)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	rd.err = err
+	return int(v)
+}
+
+func (rd *snapshotReader) bool() bool {
+	return rd.uint() == 1
+}
+
+// count reads a length, failing if it is longer than the rest of the input
+func (rd *snapshotReader) count() int {
+	n := rd.uint()
+	if rd.err == nil && n > rd.r.Len() {
+		rd.err = fmt.Errorf("Length %d is longer than the input", n)
+		return 0
+	}
+	return n
+}
+
+func (rd *snapshotReader) bytes() []byte {
+	b := make([]byte, rd.count())
+	if rd.err == nil {
+		rd.r.Read(b)
+	}
+	return b
+}
+
+func (rd *snapshotReader) string() string {
+	return string(rd.bytes())
+}
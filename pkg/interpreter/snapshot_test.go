@@ -0,0 +1,44 @@
+package interpreter
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	i := New()
+	for _, input := range []string{"let f x = x + 1", ":set n f(2)", ":output latex", ":trace on", ":break f if x > 1"} {
+		i.addToHistory(input)
+		i.interpret(input)
+	}
+	data, err := i.snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j := New()
+	if err := j.restore(data); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := j.Eval("f(n)"); err != nil || val != 4 {
+		t.Fatalf("Expected 4, found %d %v", val, err)
+	}
+	if len(j.History) != len(i.History) || j.output != outputLaTeX || j.Hook == nil {
+		t.Fatalf("Expected the history, output and tracing to be restored")
+	}
+	if bps := j.debugger.Breakpoints(); len(bps) != 1 || bps[0].Function != "f" || bps[0].Condition != "x > 1" {
+		t.Fatalf("Expected the breakpoint to be restored, found %v", bps)
+	}
+
+	old := append([]byte{}, data...)
+	binary.BigEndian.PutUint16(old[len(snapshotMagic):], snapshotVersion-1)
+	if err := j.restore(old); err == nil {
+		t.Fatalf("Expected an older version to be rejected")
+	}
+	truncated := append([]byte{}, data[:len(data)-1]...)
+	binary.BigEndian.PutUint32(truncated[len(snapshotMagic)+2:], crc32.ChecksumIEEE(truncated[snapshotHeaderSize:]))
+	if err := j.restore(truncated); err == nil {
+		t.Fatalf("Expected a truncated snapshot to be rejected")
+	}
+}
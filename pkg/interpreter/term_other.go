@@ -0,0 +1,21 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd
+
+package interpreter
+
+import "fmt"
+
+// terminal is the saved state of a terminal
+type terminal struct{}
+
+func isTerminal(fd int) bool {
+	return false
+}
+
+func makeRaw(fd int) (*terminal, error) {
+	return nil, fmt.Errorf("Raw terminal mode is not supported on this platform")
+}
+
+func (t *terminal) restore() error {
+	return nil
+}
@@ -0,0 +1,389 @@
+package lsp
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mat285/interpreter/pkg/parser"
+)
+
+// document is a source file of statements
+type document struct {
+	uri string
+	// lines are the lines of the document with comments blanked out, and source are the lines
+	// as written. Comments are blanked rune for rune, so both have the same runes at each index
+	lines      [][]rune
+	source     [][]rune
+	statements []parser.Statement
+}
+
+// definition is a `let` definition in a document
+type definition struct {
+	name string
+	// fn is nil if the definition does not parse
+	fn        *parser.Function
+	statement parser.Statement
+	// rng is the range of the name
+	rng textRange
+}
+
+func newDocument(uri, text string) *document {
+	d := &document{uri: uri}
+	for _, line := range strings.Split(parser.StripComments(text), "\n") {
+		d.lines = append(d.lines, []rune(strings.TrimSuffix(line, "\r")))
+	}
+	for _, line := range strings.Split(text, "\n") {
+		d.source = append(d.source, []rune(strings.TrimSuffix(line, "\r")))
+	}
+	d.statements, _ = parser.ReadStatements(strings.NewReader(text))
+	return d
+}
+
+// diagnostics returns the parse and type errors of the statements. Calls are checked against
+// the definitions in the document
+func (d *document) diagnostics() []diagnostic {
+	ret := []diagnostic{}
+	ctx := parser.NewContext()
+	for _, def := range d.definitions() {
+		if def.fn != nil {
+			ctx[def.name] = parser.FromFunc(def.fn)
+		}
+	}
+	for _, stmt := range d.statements {
+		src := stripOverride(stmt.Source)
+		if isCommand(src) {
+			continue
+		}
+		var err error
+		if parser.IsImport(src) {
+			_, err = parser.ParseImport(src)
+		} else if parser.IsModuleDeclaration(src) {
+			err = parseDeclaration(src)
+		} else if parser.IsDefinition(src) {
+			_, err = parser.ParseFunction(src, ctx)
+		} else {
+			var a *parser.AST
+			if a, err = parser.Parse(src); err == nil {
+				_, err = ctx.InferExpression(a.Root)
+			}
+		}
+		if err != nil {
+			ret = append(ret, diagnostic{Range: d.statementRange(stmt), Severity: severityError, Source: diagnosticSource, Message: err.Error()})
+		}
+	}
+	return ret
+}
+
+// definitions returns the `let` definitions in the document
+func (d *document) definitions() []definition {
+	ret := []definition{}
+	for _, stmt := range d.statements {
+		src := stripOverride(stmt.Source)
+		if !parser.IsDefinition(src) {
+			continue
+		}
+		name, rng, ok := d.definitionName(stmt)
+		if !ok {
+			continue
+		}
+		def := definition{name: name, statement: stmt, rng: rng}
+		if fn, err := parser.ParseFunction(src, parser.NewContext()); err == nil {
+			def.fn = fn
+		}
+		ret = append(ret, def)
+	}
+	return ret
+}
+
+// definitionName finds the name after `let` in the statement
+func (d *document) definitionName(stmt parser.Statement) (string, textRange, bool) {
+	seenLet := false
+	for line := stmt.Line - 1; line < stmt.EndLine && line < len(d.lines); line++ {
+		for _, w := range words(d.lines[line]) {
+			if !seenLet {
+				seenLet = strings.EqualFold(w.text, parser.KeywordLet)
+				continue
+			}
+			return w.text, d.wordRange(line, w), true
+		}
+	}
+	return "", textRange{}, false
+}
+
+// occurrences returns the ranges where the name is defined, called or used as a symbol, and
+// where it is listed in exports and imports. Positions come from the parsed statements, so
+// text in import paths and the members of qualified calls are left out, as are definitions
+// with an input of the same name
+func (d *document) occurrences(name string) []textRange {
+	ret := []textRange{}
+	for _, stmt := range d.statements {
+		text := d.statementText(stmt)
+		src := string(text)
+		switch {
+		case parser.IsImport(src):
+			imp, err := parser.ParseImport(src)
+			if err != nil || !hasName(imp.Names, name) {
+				continue
+			}
+			// the names follow the path, which is the first quoted string
+			open := strings.IndexRune(src, '"')
+			end := open + 1 + strings.IndexRune(src[open+1:], '"')
+			ret = append(ret, d.listed(stmt, text, len([]rune(src[:end])), name)...)
+		case parser.IsModuleDeclaration(src):
+			names, err := parser.ParseExport(src)
+			if err != nil || !hasName(names, name) {
+				continue
+			}
+			// the names follow the export keyword, which is the first word
+			ret = append(ret, d.listed(stmt, text, words(text)[0].end, name)...)
+		case parser.IsDefinition(src):
+			fn, err := parser.ParseFunction(src, parser.NewContext())
+			if err != nil || hasInput(fn, name) {
+				continue
+			}
+			if fn.Name != nil && *fn.Name == name {
+				if _, rng, ok := d.definitionName(stmt); ok {
+					ret = append(ret, rng)
+				}
+			}
+			ret = append(ret, d.references(stmt, text, fn.Body.Root, name)...)
+		case !isCommand(src):
+			if a, err := parser.Parse(src); err == nil {
+				ret = append(ret, d.references(stmt, text, a.Root, name)...)
+			}
+		}
+	}
+	return ret
+}
+
+// shadowed returns whether a definition with an input named to refers to the name, so that
+// renaming the name to `to` would make it refer to the input
+func (d *document) shadowed(name, to string) bool {
+	for _, stmt := range d.statements {
+		src := stripOverride(stmt.Source)
+		if !parser.IsDefinition(src) {
+			continue
+		}
+		fn, err := parser.ParseFunction(src, parser.NewContext())
+		if err == nil && hasInput(fn, to) && !hasInput(fn, name) && len(references(fn.Body.Root, name)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// references returns the ranges of the symbols and calls of the name in the expression
+// parsed from the text of the statement
+func (d *document) references(stmt parser.Statement, text []rune, exp *parser.Expression, name string) []textRange {
+	ret := []textRange{}
+	n := len([]rune(name))
+	for _, i := range references(exp, name) {
+		if i+n <= len(text) && string(text[i:i+n]) == name {
+			ret = append(ret, d.offsetRange(stmt, i, i+n))
+		}
+	}
+	return ret
+}
+
+// references returns the offsets of the symbols and calls of the name in the expression
+func references(exp *parser.Expression, name string) []int {
+	if exp == nil {
+		return nil
+	}
+	ret := []int{}
+	if (exp.Symbol != nil && string(*exp.Symbol) == name) || (exp.Functional != nil && exp.Functional.Name == name) {
+		ret = append(ret, exp.Index)
+	}
+	subs := []*parser.Expression{exp.Left, exp.Right}
+	if exp.Functional != nil {
+		subs = append(subs, exp.Functional.Inputs...)
+	}
+	if exp.Conditional != nil {
+		subs = append(subs, exp.Conditional.Predicate, exp.Conditional.True, exp.Conditional.False)
+	}
+	for _, sub := range subs {
+		ret = append(ret, references(sub, name)...)
+	}
+	return ret
+}
+
+// listed returns the ranges of the name in the list of names starting at the offset of the statement text
+func (d *document) listed(stmt parser.Statement, text []rune, start int, name string) []textRange {
+	ret := []textRange{}
+	for _, w := range words(text[start:]) {
+		if w.text == name {
+			ret = append(ret, d.offsetRange(stmt, start+w.start, start+w.end))
+		}
+	}
+	return ret
+}
+
+// statementText returns the lines of the statement joined by newlines, with comments, the
+// override command and continuation backslashes blanked, so offsets into it can be mapped
+// back to the document
+func (d *document) statementText(stmt parser.Statement) []rune {
+	text := []rune{}
+	for line := stmt.Line - 1; line < stmt.EndLine && line < len(d.lines); line++ {
+		if line >= stmt.Line {
+			text = append(text, '\n')
+		}
+		runes := append([]rune{}, d.lines[line]...)
+		if i := lastNonSpace(runes); i >= 0 && runes[i] == '\\' {
+			runes[i] = ' '
+		}
+		text = append(text, runes...)
+	}
+	start := 0
+	for start < len(text) && unicode.IsSpace(text[start]) {
+		start++
+	}
+	if n := len([]rune(overrideCommand)); start+n < len(text) && strings.EqualFold(string(text[start:start+n]), overrideCommand) {
+		for i := start; i < start+n; i++ {
+			text[i] = ' '
+		}
+	}
+	return text
+}
+
+// offsetRange returns the range from offset start to offset end of the statement text, which
+// must be on the same line
+func (d *document) offsetRange(stmt parser.Statement, start, end int) textRange {
+	line := stmt.Line - 1
+	for line < len(d.lines)-1 && start > len(d.lines[line]) {
+		start -= len(d.lines[line]) + 1
+		end -= len(d.lines[line]) + 1
+		line++
+	}
+	return textRange{Start: position{Line: line, Character: d.column(line, start)}, End: position{Line: line, Character: d.column(line, end)}}
+}
+
+func lastNonSpace(runes []rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if !unicode.IsSpace(runes[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// wordAt returns the identifier at the position
+func (d *document) wordAt(pos position) (string, textRange, bool) {
+	if pos.Line < 0 || pos.Line >= len(d.lines) {
+		return "", textRange{}, false
+	}
+	i := d.runeIndex(pos.Line, pos.Character)
+	for _, w := range words(d.lines[pos.Line]) {
+		if w.start <= i && i <= w.end {
+			return w.text, d.wordRange(pos.Line, w), true
+		}
+	}
+	return "", textRange{}, false
+}
+
+func (d *document) statementRange(stmt parser.Statement) textRange {
+	end := stmt.EndLine - 1
+	endChar := 0
+	if end < len(d.lines) {
+		endChar = d.column(end, len(d.lines[end]))
+	}
+	return textRange{Start: position{Line: stmt.Line - 1}, End: position{Line: end, Character: endChar}}
+}
+
+// wordRange returns the range of the word on the line
+func (d *document) wordRange(line int, w word) textRange {
+	return textRange{Start: position{Line: line, Character: d.column(line, w.start)}, End: position{Line: line, Character: d.column(line, w.end)}}
+}
+
+// column returns the character of the rune at the index on the line. The protocol counts
+// characters in UTF-16 code units, so runes outside the basic multilingual plane count twice
+func (d *document) column(line, i int) int {
+	n := 0
+	for _, r := range d.source[line][:i] {
+		n += utf16Len(r)
+	}
+	return n
+}
+
+// runeIndex returns the index of the rune at the character on the line
+func (d *document) runeIndex(line, character int) int {
+	n := 0
+	for i, r := range d.source[line] {
+		if n >= character {
+			return i
+		}
+		n += utf16Len(r)
+	}
+	return len(d.source[line])
+}
+
+// utf16Len returns the number of UTF-16 code units of the rune
+func utf16Len(r rune) int {
+	if r >= 0x10000 {
+		return 2
+	}
+	return 1
+}
+
+// word is an identifier on a line, from rune start up to rune end
+type word struct {
+	text       string
+	start, end int
+}
+
+// words returns the identifiers on the line. Function names may contain digits after the first rune
+func words(line []rune) []word {
+	ret := []word{}
+	for i := 0; i < len(line); i++ {
+		if !isWordRune(line[i]) {
+			continue
+		}
+		start := i
+		for i < len(line) && isWordRune(line[i]) {
+			i++
+		}
+		if !unicode.IsDigit(line[start]) {
+			ret = append(ret, word{text: string(line[start:i]), start: start, end: i})
+		}
+	}
+	return ret
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// stripOverride removes the override command from a definition replacing a builtin
+func stripOverride(src string) string {
+	src = strings.TrimSpace(src)
+	if len(src) > len(overrideCommand) && strings.EqualFold(src[:len(overrideCommand)], overrideCommand) {
+		return strings.TrimSpace(src[len(overrideCommand):])
+	}
+	return src
+}
+
+// parseDeclaration parses a module or export declaration
+func parseDeclaration(src string) error {
+	if fields := strings.Fields(parser.StripComments(src)); len(fields) > 0 && strings.EqualFold(fields[0], parser.KeywordModule) {
+		_, err := parser.ParseModuleDeclaration(src)
+		return err
+	}
+	_, err := parser.ParseExport(src)
+	return err
+}
+
+func isCommand(src string) bool {
+	return strings.HasPrefix(strings.TrimSpace(src), ":")
+}
+
+func hasInput(fn *parser.Function, name string) bool {
+	return hasName(fn.Inputs, name)
+}
+
+func hasName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
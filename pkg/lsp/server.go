@@ -0,0 +1,438 @@
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mat285/interpreter/pkg/parser"
+	"github.com/mat285/interpreter/pkg/wire"
+)
+
+// Server is a language server for files of statements, speaking the language server protocol.
+// The workspace is the open documents and the files under the root with the same extensions.
+// The files are read once and then kept current by save and changed file notifications
+type Server struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	root       string
+	documents  map[string]*document
+	extensions map[string]bool
+	// files are the files in the workspace by uri, or nil until they are first needed
+	files map[string]*document
+	// watch is whether the client can be asked to notify the server of changed files
+	watch bool
+	// requests counts the requests sent to the client
+	requests int
+}
+
+// NewServer creates a server reading messages from in and writing to out
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		in:         bufio.NewReader(in),
+		out:        out,
+		documents:  make(map[string]*document),
+		extensions: make(map[string]bool),
+	}
+}
+
+// Serve handles messages until the client exits or the input ends
+func (s *Server) Serve() error {
+	for {
+		msg, err := readMessage(s.in)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if msg.Method == "exit" {
+			return nil
+		} else if len(msg.Method) == 0 {
+			// a response to a request sent to the client
+			continue
+		}
+		result, err := s.handle(msg)
+		if len(msg.ID) == 0 {
+			continue
+		}
+		resp := map[string]interface{}{"jsonrpc": jsonrpcVersion, "id": msg.ID}
+		if rerr, ok := err.(*responseError); ok {
+			resp["error"] = rerr
+		} else if err != nil {
+			resp["error"] = &responseError{Code: errorRequestFailed, Message: err.Error()}
+		} else {
+			resp["result"] = result
+		}
+		if err := wire.Write(s.out, resp); err != nil {
+			return err
+		}
+	}
+}
+
+// Error returns the message of the error
+func (e *responseError) Error() string {
+	return e.Message
+}
+
+func (s *Server) handle(msg *message) (interface{}, error) {
+	switch msg.Method {
+	case "initialize":
+		params := &initializeParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		s.root = uriPath(params.RootURI)
+		s.watch = params.Capabilities.Workspace.DidChangeWatchedFiles.DynamicRegistration
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    textDocumentSyncAll,
+					"save":      map[string]bool{"includeText": false},
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{},
+				"renameProvider":     true,
+			},
+		}, nil
+	case "initialized":
+		if s.watch {
+			return nil, s.watchFiles()
+		}
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		params := &didOpenParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		if ext := filepath.Ext(uriPath(params.TextDocument.URI)); !s.extensions[ext] {
+			// files with the extension are now in the workspace
+			s.extensions[ext] = true
+			s.files = nil
+		}
+		return nil, s.open(params.TextDocument.URI, params.TextDocument.Text)
+	case "textDocument/didChange":
+		params := &didChangeParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		s.refresh(params.TextDocument.URI)
+		if n := len(params.ContentChanges); n > 0 {
+			return nil, s.open(params.TextDocument.URI, params.ContentChanges[n-1].Text)
+		}
+		return nil, nil
+	case "textDocument/didSave":
+		params := &didSaveParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		s.refresh(params.TextDocument.URI)
+		return nil, nil
+	case "textDocument/didClose":
+		params := &didCloseParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		delete(s.documents, params.TextDocument.URI)
+		s.refresh(params.TextDocument.URI)
+		return nil, s.publish(params.TextDocument.URI, []diagnostic{})
+	case "workspace/didChangeWatchedFiles":
+		params := &didChangeWatchedFilesParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		for _, change := range params.Changes {
+			s.refresh(change.URI)
+		}
+		return nil, nil
+	case "textDocument/hover":
+		params := &positionParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		return s.hover(params), nil
+	case "textDocument/definition":
+		params := &positionParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		return s.definition(params), nil
+	case "textDocument/completion":
+		return s.completion(), nil
+	case "textDocument/rename":
+		params := &renameParams{}
+		if err := unmarshal(msg, params); err != nil {
+			return nil, err
+		}
+		return s.rename(params)
+	}
+	if len(msg.ID) == 0 {
+		return nil, nil
+	}
+	return nil, &responseError{Code: errorMethodNotFound, Message: fmt.Sprintf("Unsupported method `%s`", msg.Method)}
+}
+
+// open stores the text of the document and publishes its diagnostics
+func (s *Server) open(uri, text string) error {
+	doc := newDocument(uri, text)
+	s.documents[uri] = doc
+	return s.publish(uri, doc.diagnostics())
+}
+
+// watchFiles asks the client to notify the server of changed files
+func (s *Server) watchFiles() error {
+	s.requests++
+	return wire.Write(s.out, map[string]interface{}{
+		"jsonrpc": jsonrpcVersion,
+		"id":      s.requests,
+		"method":  "client/registerCapability",
+		"params": map[string]interface{}{
+			"registrations": []map[string]interface{}{{
+				"id":              watchFilesID,
+				"method":          "workspace/didChangeWatchedFiles",
+				"registerOptions": map[string]interface{}{"watchers": []map[string]string{{"globPattern": "**/*"}}},
+			}},
+		},
+	})
+}
+
+func (s *Server) publish(uri string, diagnostics []diagnostic) error {
+	return wire.Write(s.out, map[string]interface{}{
+		"jsonrpc": jsonrpcVersion,
+		"method":  "textDocument/publishDiagnostics",
+		"params":  map[string]interface{}{"uri": uri, "diagnostics": diagnostics},
+	})
+}
+
+func (s *Server) hover(params *positionParams) interface{} {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil
+	}
+	name, rng, ok := doc.wordAt(params.Position)
+	if !ok {
+		return nil
+	}
+	for _, def := range s.definitions(name) {
+		if def.fn != nil {
+			value := "```\n" + def.fn.String() + "\n```"
+			if len(def.statement.Doc) > 0 {
+				value += "\n\n" + def.statement.Doc
+			}
+			return &hover{Contents: markupContent{Kind: markupMarkdown, Value: value}, Range: rng}
+		}
+	}
+	if b, ok := parser.LookupBuiltin(name); ok {
+		return &hover{Contents: markupContent{Kind: markupMarkdown, Value: "```\n" + b.String() + "\n```"}, Range: rng}
+	}
+	return nil
+}
+
+func (s *Server) definition(params *positionParams) interface{} {
+	ret := []location{}
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return ret
+	}
+	name, _, ok := doc.wordAt(params.Position)
+	if !ok {
+		return ret
+	}
+	for _, def := range s.definitions(name) {
+		ret = append(ret, location{URI: def.uri, Range: def.rng})
+	}
+	return ret
+}
+
+func (s *Server) completion() interface{} {
+	items := []completionItem{}
+	seen := map[string]bool{}
+	for _, doc := range s.workspace() {
+		for _, def := range doc.definitions() {
+			if seen[def.name] {
+				continue
+			}
+			seen[def.name] = true
+			item := completionItem{Label: def.name, Kind: completionFunction}
+			if def.fn != nil {
+				item.Detail = def.fn.String()
+			}
+			items = append(items, item)
+		}
+	}
+	for _, b := range parser.Builtins() {
+		if !seen[b.Name] {
+			items = append(items, completionItem{Label: b.Name, Kind: completionFunction, Detail: b.String()})
+		}
+	}
+	for _, k := range parser.Keywords {
+		items = append(items, completionItem{Label: k, Kind: completionKeyword})
+	}
+	return items
+}
+
+// rename renames the function at the position in every document of the workspace
+func (s *Server) rename(params *renameParams) (interface{}, error) {
+	doc, ok := s.documents[params.TextDocument.URI]
+	if !ok {
+		return nil, &responseError{Code: errorInvalidParams, Message: "Unknown document"}
+	}
+	name, _, ok := doc.wordAt(params.Position)
+	if !ok || len(s.definitions(name)) == 0 {
+		return nil, fmt.Errorf("Only defined functions can be renamed")
+	}
+	if err := parser.ValidateIdentifier(params.NewName); err != nil {
+		return nil, err
+	}
+	if parser.IsBuiltin(params.NewName) {
+		return nil, fmt.Errorf("Cannot rename to builtin function `%s`", params.NewName)
+	}
+	if len(s.definitions(params.NewName)) > 0 {
+		return nil, fmt.Errorf("Cannot rename to `%s` as it is already defined", params.NewName)
+	}
+	for _, doc := range s.workspace() {
+		if doc.shadowed(name, params.NewName) {
+			return nil, fmt.Errorf("Cannot rename to `%s` as it is an input of a function calling `%s`", params.NewName, name)
+		}
+	}
+	changes := map[string][]textEdit{}
+	for _, doc := range s.workspace() {
+		for _, rng := range doc.occurrences(name) {
+			changes[doc.uri] = append(changes[doc.uri], textEdit{Range: rng, NewText: params.NewName})
+		}
+	}
+	return map[string]interface{}{"changes": changes}, nil
+}
+
+// located is a definition in a document
+type located struct {
+	definition
+	uri string
+}
+
+// definitions returns the definitions of the name in the workspace
+func (s *Server) definitions(name string) []located {
+	ret := []located{}
+	for _, doc := range s.workspace() {
+		for _, def := range doc.definitions() {
+			if def.name == name {
+				ret = append(ret, located{definition: def, uri: doc.uri})
+			}
+		}
+	}
+	return ret
+}
+
+// workspace returns the open documents, and the files under the root with the extension of
+// an open document, sorted by uri
+func (s *Server) workspace() []*document {
+	if s.files == nil {
+		s.files = s.index()
+	}
+	docs := make(map[string]*document)
+	for uri, doc := range s.files {
+		docs[uri] = doc
+	}
+	for uri, doc := range s.documents {
+		docs[uri] = doc
+	}
+	ret := make([]*document, 0, len(docs))
+	for _, doc := range docs {
+		ret = append(ret, doc)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].uri < ret[j].uri })
+	return ret
+}
+
+// index reads the files in the workspace
+func (s *Server) index() map[string]*document {
+	files := make(map[string]*document)
+	if len(s.root) == 0 {
+		return files
+	}
+	filepath.Walk(s.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() {
+			if path != s.root && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !s.extensions[filepath.Ext(path)] {
+			return nil
+		}
+		uri := pathURI(path)
+		if text, err := ioutil.ReadFile(path); err == nil {
+			files[uri] = newDocument(uri, string(text))
+		}
+		return nil
+	})
+	return files
+}
+
+// refresh reads the file again if it is in the workspace, removing it if it no longer exists
+func (s *Server) refresh(uri string) {
+	path := uriPath(uri)
+	if s.files == nil || !s.inWorkspace(path) {
+		return
+	}
+	text, err := ioutil.ReadFile(path)
+	if err != nil {
+		delete(s.files, uri)
+		return
+	}
+	s.files[uri] = newDocument(uri, string(text))
+}
+
+// inWorkspace returns whether the file is under the root, outside hidden directories, with the
+// extension of an open document
+func (s *Server) inWorkspace(path string) bool {
+	if len(s.root) == 0 || len(path) == 0 || !s.extensions[filepath.Ext(path)] {
+		return false
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range strings.Split(filepath.ToSlash(filepath.Dir(rel)), "/") {
+		if dir == ".." || (dir != "." && strings.HasPrefix(dir, ".")) {
+			return false
+		}
+	}
+	return true
+}
+
+func unmarshal(msg *message, v interface{}) error {
+	if len(msg.Params) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(msg.Params, v); err != nil {
+		return &responseError{Code: errorInvalidParams, Message: err.Error()}
+	}
+	return nil
+}
+
+func uriPath(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Scheme != "file" {
+		return ""
+	}
+	return filepath.FromSlash(u.Path)
+}
+
+func pathURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
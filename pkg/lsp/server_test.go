@@ -0,0 +1,187 @@
+package lsp
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// call handles the request or notification with the params on the server
+func call(t *testing.T, s *Server, method string, params interface{}) interface{} {
+	t.Helper()
+	raw, err := json.Marshal(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := s.handle(&message{JSONRPC: jsonrpcVersion, ID: json.RawMessage("1"), Method: method, Params: raw})
+	if err != nil {
+		t.Fatalf("%s: %v", method, err)
+	}
+	return ret
+}
+
+func at(uri string, line, character int) *positionParams {
+	return &positionParams{TextDocument: textDocumentIdentifier{URI: uri}, Position: position{Line: line, Character: character}}
+}
+
+func open(t *testing.T, s *Server, uri, text string) {
+	t.Helper()
+	call(t, s, "textDocument/didOpen", &didOpenParams{TextDocument: textDocumentItem{URI: uri, Text: text}})
+}
+
+func writeFile(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func hasCompletion(items interface{}, label string) bool {
+	for _, item := range items.([]completionItem) {
+		if item.Label == label {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandlers(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "lib.fn"), "// squares\nlet sq x = x * x\n")
+	s := NewServer(&bytes.Buffer{}, &bytes.Buffer{})
+	call(t, s, "initialize", &initializeParams{RootURI: pathURI(root)})
+	main := pathURI(filepath.Join(root, "main.fn"))
+	open(t, s, main, "let f x = sq(x) + 1\nf(2)\n")
+
+	h, ok := call(t, s, "textDocument/hover", at(main, 0, 11)).(*hover)
+	if !ok || h.Contents.Value != "```\nsq = func(x) -> (x)*(x)\n```\n\nsquares" {
+		t.Fatalf("Expected the definition and doc of sq, found %+v", h)
+	}
+	locs := call(t, s, "textDocument/definition", at(main, 0, 11)).([]location)
+	if len(locs) != 1 || locs[0].URI != pathURI(filepath.Join(root, "lib.fn")) || locs[0].Range.Start.Line != 1 {
+		t.Fatalf("Expected sq to be defined on line 1 of lib.fn, found %+v", locs)
+	}
+	items := call(t, s, "textDocument/completion", at(main, 1, 0))
+	if !hasCompletion(items, "sq") || !hasCompletion(items, "f") || !hasCompletion(items, "abs") {
+		t.Fatalf("Expected completions for definitions and builtins, found %+v", items)
+	}
+
+	rename := call(t, s, "textDocument/rename", &renameParams{TextDocument: textDocumentIdentifier{URI: main}, Position: position{Character: 11}, NewName: "square"})
+	changes := rename.(map[string]interface{})["changes"].(map[string][]textEdit)
+	if len(changes) != 2 || len(changes[main]) != 1 || len(changes[pathURI(filepath.Join(root, "lib.fn"))]) != 1 {
+		t.Fatalf("Expected sq to be renamed in both files, found %+v", changes)
+	}
+	if _, err := s.handle(&message{ID: json.RawMessage("2"), Method: "textDocument/rename", Params: json.RawMessage(`{"textDocument":{"uri":"` + main + `"},"position":{"line":0,"character":11},"newName":"abs"}`)}); err == nil {
+		t.Fatalf("Expected renaming to a builtin to fail")
+	}
+}
+
+func TestWorkspaceIsCached(t *testing.T) {
+	root := t.TempDir()
+	lib := filepath.Join(root, "lib.fn")
+	writeFile(t, lib, "let sq x = x * x\n")
+	s := NewServer(&bytes.Buffer{}, &bytes.Buffer{})
+	call(t, s, "initialize", &initializeParams{RootURI: pathURI(root)})
+	main := pathURI(filepath.Join(root, "main.fn"))
+	open(t, s, main, "sq(2)\n")
+	if !hasCompletion(call(t, s, "textDocument/completion", at(main, 0, 0)), "sq") {
+		t.Fatalf("Expected sq from the workspace")
+	}
+
+	// files are not read again until the client says they changed
+	writeFile(t, lib, "let cube x = x * x * x\n")
+	if items := call(t, s, "textDocument/completion", at(main, 0, 0)); !hasCompletion(items, "sq") || hasCompletion(items, "cube") {
+		t.Fatalf("Expected the workspace to be cached")
+	}
+	call(t, s, "textDocument/didSave", &didSaveParams{TextDocument: textDocumentIdentifier{URI: pathURI(lib)}})
+	if items := call(t, s, "textDocument/completion", at(main, 0, 0)); hasCompletion(items, "sq") || !hasCompletion(items, "cube") {
+		t.Fatalf("Expected the saved file to be read again")
+	}
+
+	other := filepath.Join(root, "other.fn")
+	writeFile(t, other, "let half x = x / 2\n")
+	if err := os.Remove(lib); err != nil {
+		t.Fatal(err)
+	}
+	changes := &didChangeWatchedFilesParams{}
+	json.Unmarshal([]byte(`{"changes":[{"uri":"`+pathURI(other)+`","type":1},{"uri":"`+pathURI(lib)+`","type":3}]}`), changes)
+	call(t, s, "workspace/didChangeWatchedFiles", changes)
+	if items := call(t, s, "textDocument/completion", at(main, 0, 0)); hasCompletion(items, "cube") || !hasCompletion(items, "half") {
+		t.Fatalf("Expected created and deleted files to be applied")
+	}
+}
+
+func TestPositionsAreUTF16(t *testing.T) {
+	s := NewServer(&bytes.Buffer{}, &bytes.Buffer{})
+	uri := "file:///main.fn"
+	// the emoji is two UTF-16 code units, so f is at character 9 of the second line
+	open(t, s, uri, "let f x = x\n/* \U0001F600 */ f(1)\n")
+	h, ok := call(t, s, "textDocument/hover", at(uri, 1, 9)).(*hover)
+	if !ok {
+		t.Fatalf("Expected a hover for f")
+	}
+	if want := (textRange{Start: position{Line: 1, Character: 9}, End: position{Line: 1, Character: 10}}); h.Range != want {
+		t.Fatalf("Expected range %+v, found %+v", want, h.Range)
+	}
+	if h, _ := call(t, s, "textDocument/hover", at(uri, 1, 7)).(*hover); h != nil {
+		t.Fatalf("Expected no hover inside the comment, found %+v", h)
+	}
+
+	doc := s.documents[uri]
+	if r := doc.statementRange(doc.statements[1]); r.End.Character != 13 {
+		t.Fatalf("Expected the statement to end at character 13, found %+v", r)
+	}
+}
+
+func TestRename(t *testing.T) {
+	root := t.TempDir()
+	lib := pathURI(filepath.Join(root, "lib.fn"))
+	writeFile(t, filepath.Join(root, "lib.fn"), "export sq, cube\nlet sq x = x * x\nlet cube x = x * sq(x)\n")
+	s := NewServer(&bytes.Buffer{}, &bytes.Buffer{})
+	call(t, s, "initialize", &initializeParams{RootURI: pathURI(root)})
+	main := pathURI(filepath.Join(root, "main.fn"))
+	open(t, s, main, "from \"lib\" import sq\nimport \"sq\" as g\nlet f x = sq(x) + g.sq(x) // sq\nlet h sq = sq + 1\n:override let abs y = -sq(y) + \\\n  sq(1)\n")
+
+	rename := func(newName string) (map[string][]textEdit, error) {
+		ret, err := s.handle(&message{ID: json.RawMessage("2"), Method: "textDocument/rename", Params: json.RawMessage(`{"textDocument":{"uri":"` + main + `"},"position":{"line":2,"character":11},"newName":"` + newName + `"}`)})
+		if err != nil {
+			return nil, err
+		}
+		return ret.(map[string]interface{})["changes"].(map[string][]textEdit), nil
+	}
+	changes, err := rename("square")
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := map[string][]textRange{}
+	for uri, edits := range changes {
+		for _, edit := range edits {
+			found[uri] = append(found[uri], edit.Range)
+		}
+	}
+	span := func(line, start int) textRange {
+		return textRange{Start: position{Line: line, Character: start}, End: position{Line: line, Character: start + 2}}
+	}
+	want := map[string][]textRange{
+		lib:  {span(0, 7), span(1, 4), span(2, 17)},
+		main: {span(0, 18), span(2, 10), span(4, 23), span(5, 2)},
+	}
+	for uri, rngs := range want {
+		if len(found[uri]) != len(rngs) {
+			t.Fatalf("%s: expected %+v, found %+v", uri, rngs, found[uri])
+		}
+		for i := range rngs {
+			if found[uri][i] != rngs[i] {
+				t.Errorf("%s: expected %+v, found %+v", uri, rngs[i], found[uri][i])
+			}
+		}
+	}
+
+	for _, name := range []string{"cube", "f", "y", "abs"} {
+		if _, err := rename(name); err == nil {
+			t.Errorf("Expected renaming to %s to fail", name)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"context"
 	"fmt"
 )
 
@@ -41,7 +42,28 @@ func (a *AST) Evaluate(table ...map[string]ContextVar) *Expression {
 
 // EvaluateFull evaluates this expression down to in an int if possible, or fails
 func (a *AST) EvaluateFull(table ...map[string]ContextVar) (int, error) {
-	exp := a.Evaluate(table...)
+	t := make(map[string]ContextVar)
+	if len(table) > 0 && table[0] != nil {
+		t = table[0]
+	}
+	return a.evaluateFull(newEvaluation(nil, Limits{}), t)
+}
+
+// EvaluateContext evaluates the tree within the limits, stopping when ctx is done
+func (a *AST) EvaluateContext(ctx context.Context, limits Limits, table map[string]ContextVar) (*Expression, error) {
+	return a.Root.eval(newEvaluation(ctx, limits), table)
+}
+
+// EvaluateFullContext evaluates the tree down to an int within the limits, stopping when ctx is done
+func (a *AST) EvaluateFullContext(ctx context.Context, limits Limits, table map[string]ContextVar) (int, error) {
+	return a.evaluateFull(newEvaluation(ctx, limits), table)
+}
+
+func (a *AST) evaluateFull(e *evaluation, table map[string]ContextVar) (int, error) {
+	exp, err := a.Root.eval(e, table)
+	if err != nil {
+		return -1, err
+	}
 	if exp == nil || exp.Val == nil {
 		return -1, fmt.Errorf("Could not fully evaluate the expression. Variables still remain: %s", exp.String())
 	}
@@ -50,14 +72,19 @@ func (a *AST) EvaluateFull(table ...map[string]ContextVar) (int, error) {
 
 // Parse parses the expression into an abstract syntax tree
 func Parse(exp string) (*AST, error) {
-	e, _, err := parse([]rune(exp), 0, false)
+	e, _, err := parse([]rune(StripComments(exp)), 0, false)
 	if err != nil {
 		return nil, err
 	}
+	return newAST(e), nil
+}
+
+// newAST creates a tree with the root, building its symbol table
+func newAST(root *Expression) *AST {
 	table := SymbolTable(make(map[string]map[*Symbol]bool))
-	buildTable(e, table)
+	buildTable(root, table)
 	return &AST{
-		Root:        e,
+		Root:        root,
 		SymbolTable: table,
-	}, nil
+	}
 }
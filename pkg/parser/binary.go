@@ -0,0 +1,400 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// BinaryVersion is the version of the binary encoding of runtimes. Unmarshaling fails for other versions
+const BinaryVersion = 2
+
+const (
+	binaryValue byte = iota
+	binarySymbol
+	binaryFunction
+)
+
+const (
+	binaryExpValue byte = iota
+	binaryExpSymbol
+	binaryExpOp
+	binaryExpConditional
+	binaryExpCall
+)
+
+// MarshalBinary encodes the environment, limits, workers, search path and imports of the
+// runtime. Functions imported from modules are encoded with the contexts of their modules,
+// so they do not need their module files to be restored. Go functions and the hook are left out
+func (r *Runtime) MarshalBinary() ([]byte, error) {
+	w := &binaryWriter{}
+	w.uint(BinaryVersion)
+	w.int(r.Limits.MaxSteps)
+	w.int(r.Limits.MaxNodes)
+	w.int(r.Limits.MaxDepth)
+	w.int(r.Workers)
+	w.strings(r.SearchPath)
+	w.strings(r.Imports())
+
+	contexts := []Context{r.Environment.Snapshot()}
+	index := map[uintptr]int{reflect.ValueOf(contexts[0]).Pointer(): 0}
+	scope := func(c Context) int {
+		p := reflect.ValueOf(c).Pointer()
+		if i, ok := index[p]; ok {
+			return i
+		}
+		index[p] = len(contexts)
+		contexts = append(contexts, c)
+		return index[p]
+	}
+	encoded := [][]byte{}
+	for i := 0; i < len(contexts); i++ {
+		cw := &binaryWriter{}
+		cw.context(contexts[i], scope)
+		encoded = append(encoded, cw.buf.Bytes())
+	}
+	w.uint(len(encoded))
+	for _, e := range encoded {
+		w.buf.Write(e)
+	}
+	return w.buf.Bytes(), nil
+}
+
+// UnmarshalBinary restores a runtime encoded by MarshalBinary, replacing the environment
+// except for registered go functions
+func (r *Runtime) UnmarshalBinary(data []byte) error {
+	rd := &binaryReader{r: bytes.NewReader(data)}
+	if v := rd.uint(); rd.err == nil && v != BinaryVersion {
+		return fmt.Errorf("Unsupported binary version %d. Expected version %d", v, BinaryVersion)
+	}
+	limits := Limits{MaxSteps: rd.int(), MaxNodes: rd.int(), MaxDepth: rd.int()}
+	workers := rd.int()
+	searchPath := rd.strings()
+	imports := rd.strings()
+	n := rd.count()
+	contexts := make([]Context, n)
+	for i := range contexts {
+		contexts[i] = NewContext()
+	}
+	for i := 0; i < n && rd.err == nil; i++ {
+		rd.context(contexts[i], contexts)
+	}
+	if rd.err == nil && rd.r.Len() > 0 {
+		rd.err = fmt.Errorf("%d unexpected bytes at the end", rd.r.Len())
+	}
+	if rd.err != nil {
+		return fmt.Errorf("Invalid binary runtime. %v", rd.err)
+	}
+	if n == 0 {
+		return fmt.Errorf("Invalid binary runtime. The environment is missing")
+	}
+	r.Limits = limits
+	r.Workers = workers
+	r.SearchPath = searchPath
+	r.lock.Lock()
+	r.imports = imports
+	r.lock.Unlock()
+	return r.Environment.Update(func(ctx Context) error {
+		for k, v := range ctx {
+			if v.Builtin == nil {
+				delete(ctx, k)
+			}
+		}
+		for k, v := range contexts[0] {
+			ctx[k] = v
+		}
+		return nil
+	})
+}
+
+// binaryWriter writes integers as varints and strings with their lengths
+type binaryWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *binaryWriter) uint(v int) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutUvarint(b[:], uint64(v))])
+}
+
+func (w *binaryWriter) int(v int) {
+	var b [binary.MaxVarintLen64]byte
+	w.buf.Write(b[:binary.PutVarint(b[:], int64(v))])
+}
+
+func (w *binaryWriter) bool(v bool) {
+	if v {
+		w.buf.WriteByte(1)
+	} else {
+		w.buf.WriteByte(0)
+	}
+}
+
+func (w *binaryWriter) string(s string) {
+	w.uint(len(s))
+	w.buf.WriteString(s)
+}
+
+func (w *binaryWriter) strings(ss []string) {
+	w.uint(len(ss))
+	for _, s := range ss {
+		w.string(s)
+	}
+}
+
+// context writes the values, symbols and functions of the context in order of name. Scope
+// returns the index of the context of an imported function
+func (w *binaryWriter) context(c Context, scope func(Context) int) {
+	names := []string{}
+	for name, v := range c {
+		if v.Value != nil || v.Symbol != nil || v.Function != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	w.uint(len(names))
+	for _, name := range names {
+		v := c[name]
+		w.string(name)
+		switch {
+		case v.Value != nil:
+			w.buf.WriteByte(binaryValue)
+			w.int(int(*v.Value))
+		case v.Symbol != nil:
+			w.buf.WriteByte(binarySymbol)
+			w.string(string(*v.Symbol))
+		default:
+			f := v.Function
+			w.buf.WriteByte(binaryFunction)
+			w.bool(f.Name != nil)
+			if f.Name != nil {
+				w.string(*f.Name)
+			}
+			w.strings(f.Inputs)
+			w.string(f.Doc)
+			w.int(f.Line)
+			if f.Scope != nil {
+				w.uint(scope(f.Scope) + 1)
+			} else {
+				w.uint(0)
+			}
+			w.expression(f.Body.Root)
+		}
+	}
+}
+
+func (w *binaryWriter) expression(exp *Expression) {
+	w.bool(exp.Negate)
+	switch {
+	case exp.Val != nil:
+		w.buf.WriteByte(binaryExpValue)
+		w.int(int(*exp.Val))
+	case exp.Symbol != nil:
+		w.buf.WriteByte(binaryExpSymbol)
+		w.string(string(*exp.Symbol))
+	case exp.Conditional != nil:
+		w.buf.WriteByte(binaryExpConditional)
+		w.expression(exp.Conditional.Predicate)
+		w.expression(exp.Conditional.True)
+		w.expression(exp.Conditional.False)
+	case exp.Functional != nil:
+		w.buf.WriteByte(binaryExpCall)
+		w.string(exp.Functional.Name)
+		w.uint(len(exp.Functional.Inputs))
+		for _, input := range exp.Functional.Inputs {
+			w.expression(input)
+		}
+	default:
+		w.buf.WriteByte(binaryExpOp)
+		w.string(string(*exp.Op))
+		w.expression(exp.Left)
+		w.expression(exp.Right)
+	}
+}
+
+// binaryReader reads what binaryWriter writes. The first error is kept and later reads return zero values
+type binaryReader struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (rd *binaryReader) fail(err error) {
+	if rd.err == nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		rd.err = err
+	}
+}
+
+func (rd *binaryReader) uint() int {
+	if rd.err != nil {
+		return 0
+	}
+	v, err := binary.ReadUvarint(rd.r)
+	if err != nil {
+		rd.fail(err)
+		return 0
+	}
+	return int(v)
+}
+
+func (rd *binaryReader) int() int {
+	if rd.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(rd.r)
+	if err != nil {
+		rd.fail(err)
+		return 0
+	}
+	return int(v)
+}
+
+func (rd *binaryReader) byte() byte {
+	if rd.err != nil {
+		return 0
+	}
+	b, err := rd.r.ReadByte()
+	if err != nil {
+		rd.fail(err)
+	}
+	return b
+}
+
+func (rd *binaryReader) bool() bool {
+	return rd.byte() == 1
+}
+
+// count reads a length, failing if it is longer than the rest of the input
+func (rd *binaryReader) count() int {
+	n := rd.uint()
+	if n > rd.r.Len() {
+		rd.fail(fmt.Errorf("Length %d is longer than the input", n))
+		return 0
+	}
+	return n
+}
+
+func (rd *binaryReader) string() string {
+	n := rd.count()
+	if rd.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rd.r, b); err != nil {
+		rd.fail(err)
+		return ""
+	}
+	return string(b)
+}
+
+// name reads a name, failing if it is not an identifier or a qualified name
+func (rd *binaryReader) name() string {
+	name := rd.string()
+	if rd.err == nil {
+		if err := validateName(name); err != nil {
+			rd.fail(err)
+		}
+	}
+	return name
+}
+
+func (rd *binaryReader) strings() []string {
+	n := rd.count()
+	ret := make([]string, 0, n)
+	for i := 0; i < n && rd.err == nil; i++ {
+		ret = append(ret, rd.string())
+	}
+	return ret
+}
+
+func (rd *binaryReader) context(c Context, contexts []Context) {
+	n := rd.count()
+	for i := 0; i < n && rd.err == nil; i++ {
+		name := rd.name()
+		switch kind := rd.byte(); kind {
+		case binaryValue:
+			v := Value(rd.int())
+			c[name] = FromValue(&v)
+		case binarySymbol:
+			s := Symbol(rd.string())
+			c[name] = FromSymbol(&s)
+		case binaryFunction:
+			f := &Function{}
+			if rd.bool() {
+				fname := rd.name()
+				f.Name = &fname
+			}
+			f.Inputs = rd.strings()
+			for _, input := range f.Inputs {
+				if err := ValidateIdentifier(input); err != nil && rd.err == nil {
+					rd.fail(err)
+				}
+			}
+			f.Doc = rd.string()
+			f.Line = rd.int()
+			if s := rd.uint(); s > 0 {
+				if s > len(contexts) {
+					rd.fail(fmt.Errorf("Unknown scope %d of function `%s`", s, name))
+					return
+				}
+				f.Scope = contexts[s-1]
+			}
+			f.Body = newAST(rd.expression(0))
+			if rd.err == nil {
+				if err := f.validate(); err != nil {
+					rd.fail(fmt.Errorf("Function `%s`: %v", name, err))
+				}
+			}
+			c[name] = FromFunc(f)
+		default:
+			rd.fail(fmt.Errorf("Unknown kind %d of variable `%s`", kind, name))
+		}
+	}
+}
+
+func (rd *binaryReader) expression(depth int) *Expression {
+	if depth > maxRecursiveCalls {
+		rd.fail(fmt.Errorf("Expression is nested too deeply"))
+	}
+	if rd.err != nil {
+		return &Expression{}
+	}
+	exp := &Expression{Negate: rd.bool()}
+	switch kind := rd.byte(); kind {
+	case binaryExpValue:
+		v := Value(rd.int())
+		exp.Val = &v
+	case binaryExpSymbol:
+		s := Symbol(rd.name())
+		exp.Symbol = &s
+	case binaryExpConditional:
+		exp.Conditional = &Conditional{
+			Predicate: rd.expression(depth + 1),
+			True:      rd.expression(depth + 1),
+			False:     rd.expression(depth + 1),
+		}
+	case binaryExpCall:
+		exp.Functional = &Functional{Name: rd.name()}
+		n := rd.count()
+		exp.Functional.Inputs = make([]*Expression, 0, n)
+		for i := 0; i < n && rd.err == nil; i++ {
+			exp.Functional.Inputs = append(exp.Functional.Inputs, rd.expression(depth+1))
+		}
+	case binaryExpOp:
+		op := Operator(rd.string())
+		if rd.err == nil && !isOperator(op) {
+			rd.fail(fmt.Errorf("Unknown operator `%s`", op))
+		}
+		exp.Op = &op
+		exp.Left = rd.expression(depth + 1)
+		exp.Right = rd.expression(depth + 1)
+	default:
+		rd.fail(fmt.Errorf("Unknown expression kind %d", kind))
+	}
+	return exp
+}
@@ -0,0 +1,110 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	r := NewRuntime()
+	if _, err := r.Define("let f x = if x > 1 then x * f(x + -1) else 1"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := NewRuntime()
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := restored.Eval("f(4)"); err != nil || val != 24 {
+		t.Fatalf("Expected 24, found %d %v", val, err)
+	}
+}
+
+func TestBinaryRejectsInvalidFunctions(t *testing.T) {
+	r := NewRuntime()
+	if _, err := r.Define("let fn xx = xx + 1"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := r.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last of each name is the name of the function or the symbol in its body. Names of
+	// the same length keep the encoding valid apart from the name
+	for _, tc := range []struct{ from, to string }{
+		{"fn", "if"},
+		{"fn", "f "},
+		{"xx", "x1"},
+		{"xx", "yy"},
+	} {
+		if err := NewRuntime().UnmarshalBinary(replaceLast(data, tc.from, tc.to)); err == nil {
+			t.Errorf("Expected replacing %s with %s to fail", tc.from, tc.to)
+		}
+	}
+}
+
+func replaceLast(data []byte, from, to string) []byte {
+	i := bytes.LastIndex(data, []byte(from))
+	ret := append([]byte{}, data...)
+	copy(ret[i:], to)
+	return ret
+}
+
+// encodeOp writes a runtime with the single function `f x = x + 1`, encoding the body with
+// op writing the sides of its `+`
+func encodeOp(version int, op func(w *binaryWriter)) []byte {
+	w := &binaryWriter{}
+	w.uint(version)
+	for i := 0; i < 4; i++ {
+		w.int(0)
+	}
+	w.strings(nil)
+	w.strings(nil)
+	w.uint(1)
+	w.uint(1)
+	w.string("f")
+	w.buf.WriteByte(binaryFunction)
+	w.bool(true)
+	w.string("f")
+	w.strings([]string{"x"})
+	w.string("")
+	w.int(0)
+	w.uint(0)
+	w.bool(false)
+	w.buf.WriteByte(binaryExpOp)
+	w.string(string(Plus))
+	op(w)
+	return w.buf.Bytes()
+}
+
+func TestBinaryOperatorsHaveBothSides(t *testing.T) {
+	one := Value(1)
+	right := &Expression{Val: &one}
+	valid := encodeOp(BinaryVersion, func(w *binaryWriter) {
+		x := Symbol("x")
+		w.expression(&Expression{Symbol: &x})
+		w.expression(right)
+	})
+	r := NewRuntime()
+	if err := r.UnmarshalBinary(valid); err != nil {
+		t.Fatal(err)
+	}
+	if val, err := r.Eval("f(2)"); err != nil || val != 3 {
+		t.Fatalf("Expected 3, found %d %v", val, err)
+	}
+
+	// the first version flagged whether the left side was present
+	missingLeft := func(w *binaryWriter) {
+		w.bool(false)
+		w.expression(right)
+	}
+	if err := NewRuntime().UnmarshalBinary(encodeOp(BinaryVersion, missingLeft)); err == nil {
+		t.Errorf("Expected an operator without its left side to fail")
+	}
+	if err := NewRuntime().UnmarshalBinary(encodeOp(1, missingLeft)); err == nil {
+		t.Errorf("Expected the first version to fail")
+	}
+}
@@ -0,0 +1,279 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Builtin is a function implemented in go that can be called like a user function
+type Builtin struct {
+	Name string
+	// Arity is the number of inputs, or -1 for one or more inputs
+	Arity int
+	Usage string
+	Fn    func(args []Value) (Value, error)
+}
+
+var builtins = map[string]*Builtin{}
+
+func init() {
+	for _, b := range []*Builtin{
+		{Name: "abs", Arity: 1, Usage: "abs(x) absolute value of x", Fn: builtinAbs},
+		{Name: "min", Arity: -1, Usage: "min(a,b,...) smallest input", Fn: builtinMin},
+		{Name: "max", Arity: -1, Usage: "max(a,b,...) largest input", Fn: builtinMax},
+		{Name: "mod", Arity: 2, Usage: "mod(a,b) a modulo b, with the sign of b", Fn: builtinMod},
+		{Name: "gcd", Arity: 2, Usage: "gcd(a,b) greatest common divisor", Fn: builtinGCD},
+		{Name: "lcm", Arity: 2, Usage: "lcm(a,b) least common multiple", Fn: builtinLCM},
+		{Name: "sqrt", Arity: 1, Usage: "sqrt(x) integer square root of x", Fn: builtinSqrt},
+		{Name: "floor", Arity: 1, Usage: "floor(x) x rounded down, which is x as values are integers", Fn: builtinIdentity},
+		{Name: "ceil", Arity: 1, Usage: "ceil(x) x rounded up, which is x as values are integers", Fn: builtinIdentity},
+		{Name: "round", Arity: 1, Usage: "round(x) x rounded to nearest, which is x as values are integers", Fn: builtinIdentity},
+		{Name: "log", Arity: 1, Usage: "log(x) natural log of x", Fn: floatBuiltin(math.Log)},
+		{Name: "exp", Arity: 1, Usage: "exp(x) e to the power x", Fn: floatBuiltin(math.Exp)},
+		{Name: "sin", Arity: 1, Usage: "sin(x) sine of x radians", Fn: floatBuiltin(math.Sin)},
+		{Name: "cos", Arity: 1, Usage: "cos(x) cosine of x radians", Fn: floatBuiltin(math.Cos)},
+		{Name: "tan", Arity: 1, Usage: "tan(x) tangent of x radians", Fn: floatBuiltin(math.Tan)},
+		{Name: "pi", Arity: 0, Usage: "pi() the constant pi, truncated to 3 as values are integers", Fn: constBuiltin(math.Pi)},
+		{Name: "e", Arity: 0, Usage: "e() the constant e, truncated to 2 as values are integers", Fn: constBuiltin(math.E)},
+		{Name: "fact", Arity: 1, Usage: "fact(n) factorial of n", Fn: builtinFact},
+		{Name: "choose", Arity: 2, Usage: "choose(n,k) binomial coefficient n choose k", Fn: builtinChoose},
+	} {
+		builtins[b.Name] = b
+	}
+}
+
+// IsBuiltin returns whether the name is a builtin function
+func IsBuiltin(name string) bool {
+	_, ok := builtins[name]
+	return ok
+}
+
+// LookupBuiltin returns the builtin function with the name if it exists
+func LookupBuiltin(name string) (*Builtin, bool) {
+	b, ok := builtins[name]
+	return b, ok
+}
+
+// Builtins returns all of the builtin functions sorted by name
+func Builtins() []*Builtin {
+	ret := make([]*Builtin, 0, len(builtins))
+	for _, b := range builtins {
+		ret = append(ret, b)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+	return ret
+}
+
+// Call calls the builtin with the given inputs, which must all be values
+func (b *Builtin) Call(inputs ...ContextVar) (Value, error) {
+	if b.Arity >= 0 && len(inputs) != b.Arity {
+		return -1, fmt.Errorf("Input length differs from give inputs. Expected %d inputs, found %d", b.Arity, len(inputs))
+	}
+	if b.Arity < 0 && len(inputs) == 0 {
+		return -1, fmt.Errorf("Missing inputs for `%s`. Expected at least 1 input", b.Name)
+	}
+	args := make([]Value, 0, len(inputs))
+	for _, in := range inputs {
+		if in.Value == nil {
+			return -1, fmt.Errorf("Cannot call `%s` with non value input `%s`", b.Name, in.String())
+		}
+		args = append(args, *in.Value)
+	}
+	v, err := b.Fn(args)
+	if err != nil {
+		return -1, &builtinError{err: err}
+	}
+	return v, nil
+}
+
+// builtinError is an error of a builtin for inputs it is not defined for, such as sqrt(-1).
+// It ends the evaluation, where other failed calls are left unevaluated
+type builtinError struct {
+	err error
+}
+
+func (e *builtinError) Error() string {
+	return e.err.Error()
+}
+
+func (e *builtinError) Unwrap() error {
+	return e.err
+}
+
+// String returns a string representation of this builtin
+func (b *Builtin) String() string {
+	if len(b.Usage) > 0 {
+		return b.Usage
+	}
+	if b.Arity < 0 {
+		return fmt.Sprintf("%s = builtin(...)", b.Name)
+	}
+	return fmt.Sprintf("%s = builtin(%d)", b.Name, b.Arity)
+}
+
+// call calls the named function from the context or the builtins
+func call(e *evaluation, context Context, name string, inputs ...ContextVar) (val Value, err error) {
+	if err := e.enter(name); err != nil {
+		return -1, err
+	}
+	defer e.exit()
+	ret := e.traceCall(name, inputs)
+	defer func() { ret(val, err) }()
+	if fn, ok := context[name]; ok && fn.Function != nil {
+		if fn.Function.Scope != nil {
+			context = fn.Function.Scope
+		}
+		val, err := fn.Function.evaluate(e, context, inputs...)
+		return Value(val), err
+	} else if ok && fn.Builtin != nil {
+		return fn.Builtin.Call(inputs...)
+	}
+	if b, ok := builtins[name]; ok {
+		return b.Call(inputs...)
+	}
+	return -1, fmt.Errorf("Unknown function `%s`", name)
+}
+
+func builtinAbs(args []Value) (Value, error) {
+	if args[0] < 0 {
+		return -args[0], nil
+	}
+	return args[0], nil
+}
+
+func builtinMin(args []Value) (Value, error) {
+	ret := args[0]
+	for _, a := range args[1:] {
+		if a < ret {
+			ret = a
+		}
+	}
+	return ret, nil
+}
+
+func builtinMax(args []Value) (Value, error) {
+	ret := args[0]
+	for _, a := range args[1:] {
+		if a > ret {
+			ret = a
+		}
+	}
+	return ret, nil
+}
+
+func builtinMod(args []Value) (Value, error) {
+	if args[1] == 0 {
+		return -1, fmt.Errorf("Division by zero in mod")
+	}
+	return (args[0]%args[1] + args[1]) % args[1], nil
+}
+
+func gcd(a, b Value) Value {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func builtinGCD(args []Value) (Value, error) {
+	return gcd(args[0], args[1]), nil
+}
+
+func builtinLCM(args []Value) (Value, error) {
+	if args[0] == 0 || args[1] == 0 {
+		return 0, nil
+	}
+	q := args[0] / gcd(args[0], args[1])
+	l := q * args[1]
+	// the product overflowed if it does not divide back, or if its absolute value does not fit
+	if l/args[1] != q || l == math.MinInt {
+		return -1, fmt.Errorf("lcm of %d and %d is too large", args[0], args[1])
+	}
+	if l < 0 {
+		l = -l
+	}
+	return l, nil
+}
+
+func builtinSqrt(args []Value) (Value, error) {
+	if args[0] < 0 {
+		return -1, fmt.Errorf("Cannot take sqrt of negative value %d", args[0])
+	}
+	r := Value(math.Sqrt(float64(args[0])))
+	// correct for float rounding on large inputs
+	for r*r > args[0] {
+		r--
+	}
+	for (r+1)*(r+1) <= args[0] {
+		r++
+	}
+	return r, nil
+}
+
+func builtinIdentity(args []Value) (Value, error) {
+	return args[0], nil
+}
+
+func builtinFact(args []Value) (Value, error) {
+	n := args[0]
+	if n < 0 {
+		return -1, fmt.Errorf("Cannot take factorial of negative value %d", n)
+	}
+	ret := Value(1)
+	for i := Value(2); i <= n; i++ {
+		if ret > math.MaxInt/i {
+			return -1, fmt.Errorf("Factorial of %d is too large", n)
+		}
+		ret *= i
+	}
+	return ret, nil
+}
+
+func builtinChoose(args []Value) (Value, error) {
+	n, k := args[0], args[1]
+	if k < 0 || k > n {
+		return 0, nil
+	}
+	if k > n-k {
+		k = n - k
+	}
+	ret := Value(1)
+	for i := Value(1); i <= k; i++ {
+		// ret*(n-k+i) is divisible by i, as it is i times n-k+i choose i
+		if ret > math.MaxInt/(n-k+i) {
+			return -1, fmt.Errorf("%d choose %d is too large", n, k)
+		}
+		ret = ret * (n - k + i) / i
+	}
+	return ret, nil
+}
+
+// constBuiltin returns a constant truncated to a value
+func constBuiltin(c float64) func([]Value) (Value, error) {
+	return func([]Value) (Value, error) {
+		return Value(c), nil
+	}
+}
+
+// floatBuiltin wraps a float function, truncating the result to a value. Results that do
+// not fit in a value are errors rather than wrapping around
+func floatBuiltin(fn func(float64) float64) func([]Value) (Value, error) {
+	return func(args []Value) (Value, error) {
+		f := fn(float64(args[0]))
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			return -1, fmt.Errorf("Result is not a finite number for input %d", args[0])
+		}
+		// float64(math.MaxInt64) rounds up to 2^63, which is out of range
+		if f >= math.MaxInt64 || f < math.MinInt64 {
+			return -1, fmt.Errorf("Result %g is too large for input %d", f, args[0])
+		}
+		return Value(f), nil
+	}
+}
@@ -0,0 +1,88 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuiltins(t *testing.T) {
+	cases := []struct {
+		src  string
+		want Value
+		err  string
+	}{
+		{src: "floor(7) + ceil(-3) + round(2)", want: 6},
+		{src: "fact(20)", want: 2432902008176640000},
+		{src: "fact(21)", err: "too large"},
+		{src: "choose(60, 30)", want: 118264581564861424},
+		{src: "choose(70, 35)", err: "too large"},
+		{src: "sqrt(-1) + 1", err: "Cannot take sqrt of negative value -1"},
+		{src: "mod(3, 0)", err: "Division by zero"},
+		{src: "lcm(4, -6) + lcm(0, 3)", want: 12},
+		{src: "lcm(4611686018427387904, 3)", err: "too large"},
+		{src: "lcm(-9223372036854775807 + -1, 1)", err: "too large"},
+		{src: "exp(43)", want: 4727839468229346304},
+		{src: "exp(44)", err: "too large"},
+		{src: "log(0)", err: "not a finite number"},
+		{src: "pi() * 10 + e()", want: 32},
+	}
+	r := NewRuntime()
+	for _, c := range cases {
+		v, err := r.Eval(c.src)
+		if len(c.err) > 0 {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: expected error containing %q, got %v", c.src, c.err, err)
+			}
+		} else if err != nil || v != c.want {
+			t.Errorf("%s: expected %d, got %d, %v", c.src, c.want, v, err)
+		}
+	}
+}
+
+func TestBuiltinErrorInFunction(t *testing.T) {
+	r := NewRuntime()
+	if _, err := r.Define("let f x = sqrt(x) + 1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Eval("f(-4)"); err == nil || !strings.Contains(err.Error(), "negative value -4") {
+		t.Errorf("expected the sqrt error, got %v", err)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	r := NewRuntime()
+	double := func(args []Value) (Value, error) { return args[0] * 2, nil }
+	if err := r.RegisterFunc("double", 1, double); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Define("let half x = x / 2"); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		name  string
+		arity int
+	}{
+		{"abs", 1},
+		{"double", 1},
+		{"half", 1},
+		{"if", 1},
+		{"neg", -2},
+	} {
+		if err := r.RegisterFunc(c.name, c.arity, double); err == nil {
+			t.Errorf("%s: expected registering with arity %d to fail", c.name, c.arity)
+		}
+	}
+	if v, err := r.Eval("abs(-3) + half(4)"); err != nil || v != 5 {
+		t.Fatalf("expected the builtin and definition to stay, got %d, %v", v, err)
+	}
+
+	if err := r.OverrideFunc("abs", 1, double); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.OverrideFunc("half", 1, double); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.Eval("abs(-3) + half(4) + double(1)"); err != nil || v != 4 {
+		t.Fatalf("expected the overrides to be called, got %d, %v", v, err)
+	}
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"strings"
+	"unicode"
+)
+
+// comment is the position of a comment in source, in runes
+type comment struct {
+	start, end int
+	block      bool
+	// open is whether the comment is a block comment missing its end
+	open bool
+}
+
+// findComments returns the comments in the source in order
+func findComments(runes []rune) []comment {
+	ret := []comment{}
+	for i := 0; i < len(runes); i++ {
+		switch {
+		case hasPrefix(runes[i:], CommentLine), hasPrefix(runes[i:], CommentSlashes):
+			c := comment{start: i, end: len(runes)}
+			for j := i; j < len(runes); j++ {
+				if runes[j] == '\n' {
+					c.end = j
+					break
+				}
+			}
+			ret = append(ret, c)
+			i = c.end
+		case hasPrefix(runes[i:], CommentBlockStart):
+			c := comment{start: i, end: len(runes), block: true, open: true}
+			for j := i + len(CommentBlockStart); j < len(runes); j++ {
+				if hasPrefix(runes[j:], CommentBlockEnd) {
+					c.end = j + len(CommentBlockEnd)
+					c.open = false
+					break
+				}
+			}
+			ret = append(ret, c)
+			i = c.end - 1
+		}
+	}
+	return ret
+}
+
+func hasPrefix(runes []rune, prefix string) bool {
+	p := []rune(prefix)
+	if len(runes) < len(p) {
+		return false
+	}
+	for i, r := range p {
+		if runes[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+// StripComments replaces the comments in the source with spaces, keeping newlines so that
+// positions in the source are unchanged
+func StripComments(src string) string {
+	runes := []rune(src)
+	for _, c := range findComments(runes) {
+		for i := c.start; i < c.end; i++ {
+			if runes[i] != '\n' {
+				runes[i] = ' '
+			}
+		}
+	}
+	return string(runes)
+}
+
+// Comments returns the text of each line of the comments in the source, without the comment markers
+func Comments(src string) []string {
+	runes := []rune(src)
+	ret := []string{}
+	for _, c := range findComments(runes) {
+		text := string(runes[c.start:c.end])
+		if c.block {
+			text = strings.TrimPrefix(text, CommentBlockStart)
+			text = strings.TrimSuffix(text, CommentBlockEnd)
+		} else {
+			text = strings.TrimPrefix(strings.TrimPrefix(text, CommentSlashes), CommentLine)
+		}
+		for _, line := range strings.Split(text, "\n") {
+			ret = append(ret, strings.TrimSpace(line))
+		}
+	}
+	return ret
+}
+
+// rawComments returns each comment in the source as written
+func rawComments(src string) []string {
+	runes := []rune(src)
+	ret := []string{}
+	for _, c := range findComments(runes) {
+		ret = append(ret, string(runes[c.start:c.end]))
+	}
+	return ret
+}
+
+// inComment returns whether the source ends inside a block comment
+func inComment(src string) bool {
+	comments := findComments([]rune(src))
+	return len(comments) > 0 && comments[len(comments)-1].open
+}
+
+// closeLineComment turns a line comment at the end of the source into a block comment, so
+// that the next line can be joined on without becoming part of the comment
+func closeLineComment(src string) string {
+	runes := []rune(src)
+	comments := findComments(runes)
+	if len(comments) == 0 {
+		return src
+	}
+	c := comments[len(comments)-1]
+	if c.block || c.end != len(runes) {
+		return src
+	}
+	text := strings.TrimSpace(Comments(string(runes[c.start:]))[0])
+	code := strings.TrimRightFunc(string(runes[:c.start]), unicode.IsSpace)
+	if len(text) == 0 || strings.Contains(text, CommentBlockEnd) {
+		return code
+	}
+	return code + " " + CommentBlockStart + " " + text + " " + CommentBlockEnd
+}
+
+// DocComment formats the doc as line comments
+func DocComment(doc string) string {
+	lines := []string{}
+	for _, line := range strings.Split(doc, "\n") {
+		lines = append(lines, strings.TrimSpace(CommentLine+" "+line))
+	}
+	return strings.Join(lines, "\n")
+}
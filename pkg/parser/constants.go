@@ -10,7 +10,39 @@ const (
 	// KeywordLet is the keyword for let
 	KeywordLet = "let"
 
-	maxRecursiveCalls = 2 << 20
+	// KeywordModule, KeywordExport, KeywordImport, KeywordFrom and KeywordAs are the keywords
+	// of module statements. They are only keywords at the start of a statement
+	KeywordModule = "module"
+	KeywordExport = "export"
+	KeywordImport = "import"
+	KeywordFrom   = "from"
+	KeywordAs     = "as"
+
+	// QualifierSeparator separates the qualifier of an imported function from its name, as in g.area
+	QualifierSeparator = "."
+	// ModuleExtension is the extension tried when a module path is not found as given
+	ModuleExtension = ".fn"
+
+	// CommentLine starts a comment running to the end of the line
+	CommentLine = "#"
+	// CommentSlashes also starts a comment running to the end of the line
+	CommentSlashes = "//"
+	// CommentBlockStart starts a block comment, which may span several lines
+	CommentBlockStart = "/*"
+	// CommentBlockEnd ends a block comment
+	CommentBlockEnd = "*/"
+
+	// maxRecursiveCalls bounds nested calls. Each call takes a few kilobytes of stack, and
+	// overflowing the 1GB goroutine stack is a fatal error rather than a panic, which happens at
+	// around 350k nested calls. It is kept well below that
+	maxRecursiveCalls = 2 << 16
+
+	contextCheckInterval = 1 << 8
+
+	maxExplainSteps = 1 << 10
+
+	formatLineWidth = 80
+	formatIndent    = "  "
 )
 
 var (
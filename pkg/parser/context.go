@@ -1,15 +1,20 @@
 package parser
 
-import "fmt"
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
 
 // Context is the context under which things are parsed
 type Context map[string]ContextVar
 
-// ContextVar is a type that can be a symbol or a value
+// ContextVar is a type that can be a symbol, a value, a function or a builtin
 type ContextVar struct {
 	*Symbol
 	*Value
 	*Function
+	*Builtin
 }
 
 // NewContext creates a new context
@@ -26,13 +31,49 @@ func (c Context) Clone() Context {
 	return ret
 }
 
-// Source returns a source code string for the functions in this context
+// Source returns a source code string for the functions in this context, with each function
+// after the functions it calls. Functions imported from modules are left out. A function
+// replacing a builtin is declared with `let` like any other, so it must be defined with Override
 func (c Context) Source() string {
-	ret := ""
-	for _, v := range c {
-		if v.Function != nil {
-			ret = fmt.Sprintf("%s\n", v.Function.Declaration())
+	lines := []string{}
+	for _, f := range c.Functions() {
+		if len(f.Doc) > 0 {
+			lines = append(lines, DocComment(f.Doc))
 		}
+		lines = append(lines, f.Declaration())
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// Functions returns the functions defined in this context in order of name, moving each
+// function after the functions it calls. Functions imported from modules are left out
+func (c Context) Functions() []*Function {
+	names := []string{}
+	for name, v := range c {
+		if v.Function != nil && v.Function.Scope == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	ret := []*Function{}
+	seen := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		v, ok := c[name]
+		if !ok || v.Function == nil || v.Function.Scope != nil || seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, callee := range v.Function.calls() {
+			visit(callee)
+		}
+		ret = append(ret, v.Function)
+	}
+	for _, name := range names {
+		visit(name)
 	}
 	return ret
 }
@@ -47,22 +88,67 @@ func (c ContextVar) String() string {
 	if c.Function != nil {
 		return c.Function.String()
 	}
+	if c.Builtin != nil {
+		return c.Builtin.String()
+	}
 	return "" // make clearer
 }
 
 // FromSymbol returns a Symbol ContextVar
 func FromSymbol(s *Symbol) ContextVar {
-	return ContextVar{s, nil, nil}
+	return ContextVar{s, nil, nil, nil}
 }
 
 // FromValue returns a Value ContextVar
 func FromValue(v *Value) ContextVar {
-	return ContextVar{nil, v, nil}
+	return ContextVar{nil, v, nil, nil}
 }
 
 // FromFunc Creates a context var from a function
 func FromFunc(f *Function) ContextVar {
-	return ContextVar{nil, nil, f}
+	return ContextVar{nil, nil, f, nil}
+}
+
+// FromBuiltin creates a context var from a builtin
+func FromBuiltin(b *Builtin) ContextVar {
+	return ContextVar{nil, nil, nil, b}
+}
+
+// RegisterFunc registers a go function in this context under the name, which must not
+// already be defined or be a builtin. Arity is the number of inputs the function takes, or -1
+// for one or more inputs. The function may be called from several goroutines at once
+func (c Context) RegisterFunc(name string, arity int, fn func(args []Value) (Value, error)) error {
+	return c.registerFunc(name, arity, fn, false)
+}
+
+// OverrideFunc is RegisterFunc, replacing a builtin or definition with the same name
+func (c Context) OverrideFunc(name string, arity int, fn func(args []Value) (Value, error)) error {
+	return c.registerFunc(name, arity, fn, true)
+}
+
+func (c Context) registerFunc(name string, arity int, fn func(args []Value) (Value, error), override bool) error {
+	if fn == nil {
+		return fmt.Errorf("Cannot register nil function `%s`", name)
+	}
+	if err := ValidateIdentifier(name); err != nil {
+		return err
+	}
+	if arity < -1 {
+		return fmt.Errorf("Invalid arity %d of `%s`. Expected -1 or more", arity, name)
+	}
+	if _, ok := c[name]; (ok || IsBuiltin(name)) && !override {
+		return fmt.Errorf("Cannot register `%s` as it is already defined", name)
+	}
+	c[name] = FromBuiltin(&Builtin{Name: name, Arity: arity, Fn: fn})
+	return nil
+}
+
+// IsBuiltin returns whether the name is a builtin or a go function registered in this context
+func (c Context) IsBuiltin(name string) bool {
+	if v, ok := c[name]; ok && v.Builtin != nil {
+		return true
+	}
+	return IsBuiltin(name)
 }
 
 // FromIntMap transforms the int map into t symbolvalue map
@@ -0,0 +1,72 @@
+package parser
+
+import "strings"
+
+// Incomplete returns whether the source is an unfinished statement that continues on the next
+// line. A statement is unfinished if it ends with `\`, an operator or a comma, has unclosed
+// parentheses, has an `if` without an `else`, is a `let` without a body, or is inside a block comment.
+// Other comments are ignored
+func Incomplete(src string) bool {
+	if inComment(src) {
+		return true
+	}
+	src = strings.TrimSpace(StripComments(src))
+	if len(src) == 0 {
+		return false
+	}
+	if strings.HasSuffix(src, "\\") {
+		return true
+	}
+
+	depth := 0
+	for _, r := range src {
+		if r == '(' {
+			depth++
+		} else if r == ')' {
+			depth--
+		}
+	}
+	if depth > 0 {
+		return true
+	}
+
+	ifs := 0
+	elses := 0
+	words := strings.FieldsFunc(src, func(r rune) bool { return !IsIdentifierRune(r) })
+	for _, word := range words {
+		if word == KeywordIf {
+			ifs++
+		} else if word == KeywordElse {
+			elses++
+		}
+	}
+	if ifs > elses {
+		return true
+	}
+
+	runes := []rune(src)
+	last := runes[len(runes)-1]
+	if isOp(last) || last == '-' || last == ',' {
+		return true
+	}
+	if len(words) > 0 && IsIdentifierRune(last) {
+		lastWord := words[len(words)-1]
+		if lastWord == KeywordIf || lastWord == KeywordThen || lastWord == KeywordElse {
+			return true
+		}
+	}
+	return IsDefinition(src) && !strings.ContainsRune(src, '=')
+}
+
+// startsStatement returns whether the line starts a `let`, import, module or export statement,
+// which cannot continue another statement
+func startsStatement(line string) bool {
+	return IsDefinition(line) || IsImport(line) || IsModuleDeclaration(line)
+}
+
+// JoinLines joins a continuation line onto an unfinished statement. A line comment ending the
+// statement is made a block comment so that it does not take in the joined line
+func JoinLines(src, line string) string {
+	src = strings.TrimSuffix(strings.TrimSpace(closeLineComment(src)), "\\")
+	return strings.TrimSpace(strings.TrimSpace(src) + " " + strings.TrimSpace(line))
+}
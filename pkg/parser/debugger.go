@@ -0,0 +1,301 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrAborted is returned when a debugged evaluation is aborted
+var ErrAborted = errors.New("Evaluation aborted")
+
+// Action is how a debugger resumes after it stops
+type Action int
+
+const (
+	// Continue runs until the next breakpoint
+	Continue Action = iota
+	// StepIn stops at the next function call
+	StepIn
+	// StepOver stops at the next function call that is not nested in the current one
+	StepOver
+	// StepOut stops at the next function call after the current one returns
+	StepOut
+	// Abort stops the evaluation with ErrAborted
+	Abort
+)
+
+// Breakpoint stops a debugged evaluation when the function is called and the condition,
+// evaluated against the inputs of the call, is not 0
+type Breakpoint struct {
+	ID        int
+	Function  string
+	Condition string
+
+	cond *AST
+}
+
+// String returns a string representation of this breakpoint
+func (b *Breakpoint) String() string {
+	str := fmt.Sprintf("[%d] %s", b.ID, b.Function)
+	if b.cond != nil {
+		str += fmt.Sprintf(" %s %s", KeywordIf, b.Condition)
+	}
+	return str
+}
+
+// Frame is a function call in progress
+type Frame struct {
+	Name  string
+	Args  []Value
+	Depth int
+	// Line is the line the function was defined on, or 0
+	Line int
+	// Locals are the inputs of the function by name
+	Locals Context
+
+	// scope is the context the function is evaluated in, which is the context of its module
+	// for a function imported from one
+	scope Context
+}
+
+// String returns the call of this frame
+func (f *Frame) String() string {
+	return callString(f.Name, f.Args)
+}
+
+// Stop is where a debugged evaluation stopped
+type Stop struct {
+	// Frame is the call about to be evaluated
+	Frame *Frame
+	// Stack is the calls in progress, innermost last, ending with Frame
+	Stack []*Frame
+	// Breakpoint is the breakpoint that was hit, or nil when stepping
+	Breakpoint *Breakpoint
+}
+
+// Debugger evaluates expressions against a runtime, stopping at breakpoints and after steps.
+// It is an EvalHook, and runs one evaluation at a time
+type Debugger struct {
+	Runtime *Runtime
+	// Stopped is called on the evaluating goroutine each time the evaluation stops. The
+	// evaluation resumes with the returned action once it returns
+	Stopped func(s *Stop) Action
+
+	lock        sync.Mutex
+	breakpoints []*Breakpoint
+	nextID      int
+
+	global  Context
+	stack   []*Frame
+	action  Action
+	depth   int
+	aborted bool
+	cancel  context.CancelFunc
+}
+
+// NewDebugger creates a debugger for the runtime
+func NewDebugger(r *Runtime, stopped func(s *Stop) Action) *Debugger {
+	return &Debugger{Runtime: r, Stopped: stopped, nextID: 1}
+}
+
+// Break adds a breakpoint on the function, which may be the qualified name of an imported
+// function. The condition is optional
+func (d *Debugger) Break(function, condition string) (*Breakpoint, error) {
+	if err := validateName(function); err != nil {
+		return nil, err
+	}
+	b := &Breakpoint{Function: function, Condition: strings.TrimSpace(condition)}
+	if len(b.Condition) > 0 {
+		cond, err := Parse(b.Condition)
+		if err != nil {
+			return nil, err
+		}
+		b.cond = cond
+	}
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	b.ID = d.nextID
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, b)
+	return b, nil
+}
+
+// Delete removes the breakpoint with the id
+func (d *Debugger) Delete(id int) error {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	for i, b := range d.breakpoints {
+		if b.ID == id {
+			d.breakpoints = append(d.breakpoints[:i], d.breakpoints[i+1:]...)
+			return nil
+		}
+	}
+	return fmt.Errorf("No breakpoint [%d]", id)
+}
+
+// ClearBreakpoints removes all of the breakpoints
+func (d *Debugger) ClearBreakpoints() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.breakpoints = nil
+}
+
+// Breakpoints returns the breakpoints in the order they were added
+func (d *Debugger) Breakpoints() []*Breakpoint {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]*Breakpoint{}, d.breakpoints...)
+}
+
+// Eval parses and fully evaluates the expression, stopping at breakpoints. If step is
+// true it also stops at the first function call
+func (d *Debugger) Eval(ctx context.Context, src string, step bool) (Value, error) {
+	a, err := Parse(strings.TrimSpace(src))
+	if err != nil {
+		return -1, err
+	}
+	return d.EvalTree(ctx, a, d.Runtime.Environment.Snapshot(), step)
+}
+
+// EvalTree fully evaluates the parsed expression in the context, stopping at breakpoints. If
+// step is true it also stops at the first function call
+func (d *Debugger) EvalTree(ctx context.Context, a *AST, vars Context, step bool) (Value, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	d.global = vars
+	d.stack = nil
+	d.action = Continue
+	if step {
+		d.action = StepIn
+	}
+	d.aborted = false
+	d.cancel = cancel
+
+	e := newEvaluation(ctx, d.Runtime.Limits)
+	e.hook = d
+	val, err := a.evaluateFull(e, d.global)
+	if d.aborted {
+		return -1, ErrAborted
+	}
+	if err != nil {
+		return -1, err
+	}
+	return Value(val), nil
+}
+
+// EvalFrame fully evaluates the expression against the locals of the frame, in the scope the
+// function of the frame is evaluated in
+func (d *Debugger) EvalFrame(frame *Frame, src string) (Value, error) {
+	a, err := Parse(strings.TrimSpace(src))
+	if err != nil {
+		return -1, err
+	}
+	scope := frame.scope
+	if scope == nil {
+		scope = d.global
+	}
+	if scope == nil {
+		scope = d.Runtime.Environment.Snapshot()
+	}
+	val, err := a.evaluateFull(newEvaluation(nil, d.Runtime.Limits), StitchContext(frame.Locals, scope))
+	return Value(val), err
+}
+
+// Call pushes a frame for the call and stops if a breakpoint is hit or a step is done
+func (d *Debugger) Call(depth int, name string, args []Value) {
+	if d.Runtime.Hook != nil {
+		d.Runtime.Hook.Call(depth, name, args)
+	}
+	// the name is resolved like the call is, in the scope of the calling function
+	scope := d.global
+	if len(d.stack) > 0 {
+		scope = d.stack[len(d.stack)-1].scope
+	}
+	frame := &Frame{Name: name, Args: args, Depth: depth, Locals: NewContext(), scope: scope}
+	if v, ok := scope[name]; ok && v.Function != nil {
+		frame.Line = v.Function.Line
+		frame.Locals = locals(v.Function, args)
+		if v.Function.Scope != nil {
+			frame.scope = v.Function.Scope
+		}
+	}
+	d.stack = append(d.stack, frame)
+	if d.aborted {
+		return
+	}
+	stop := d.hit(frame)
+	switch {
+	case stop != nil:
+	case d.action == StepIn,
+		d.action == StepOver && depth <= d.depth,
+		d.action == StepOut && depth < d.depth:
+		stop = &Stop{}
+	default:
+		return
+	}
+	stop.Frame = frame
+	stop.Stack = append([]*Frame{}, d.stack...)
+	d.depth = depth
+	d.action = Continue
+	if d.Stopped != nil {
+		d.action = d.Stopped(stop)
+	}
+	if d.action == Abort {
+		d.aborted = true
+		d.cancel()
+	}
+}
+
+// Return pops the frame of the call
+func (d *Debugger) Return(depth int, name string, args []Value, result Value, err error) {
+	if d.Runtime.Hook != nil {
+		d.Runtime.Hook.Return(depth, name, args, result, err)
+	}
+	if len(d.stack) > 0 {
+		d.stack = d.stack[:len(d.stack)-1]
+	}
+}
+
+// Branch passes the branch on to the hook of the runtime
+func (d *Debugger) Branch(depth int, cond *Conditional, predicate Value) {
+	if d.Runtime.Hook != nil {
+		d.Runtime.Hook.Branch(depth, cond, predicate)
+	}
+}
+
+// hit returns a stop for the first breakpoint hit by the call, or nil
+func (d *Debugger) hit(frame *Frame) *Stop {
+	for _, b := range d.Breakpoints() {
+		if b.Function != frame.Name {
+			continue
+		}
+		if b.cond != nil {
+			v, err := b.cond.evaluateFull(newEvaluation(nil, d.Runtime.Limits), StitchContext(frame.Locals, frame.scope))
+			if err != nil || v == 0 {
+				continue
+			}
+		}
+		return &Stop{Breakpoint: b}
+	}
+	return nil
+}
+
+// locals maps the inputs of the function to the arguments of the call
+func locals(f *Function, args []Value) Context {
+	locals := NewContext()
+	if len(f.Inputs) != len(args) {
+		return locals
+	}
+	for i, input := range f.Inputs {
+		val := args[i]
+		locals[input] = FromValue(&val)
+	}
+	return locals
+}
@@ -0,0 +1,50 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDebuggerInModules(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "geo.fn"), []byte("let sq x = x * x\nlet area w = sq(w) + 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := NewRuntime()
+	if _, err := r.Import(`import "geo" as geo`, dir); err != nil {
+		t.Fatal(err)
+	}
+	// a global function with the name of the one called within the module
+	if _, err := r.Define("let sq a b = a + b"); err != nil {
+		t.Fatal(err)
+	}
+
+	stops := []*Frame{}
+	var d *Debugger
+	d = NewDebugger(r, func(s *Stop) Action {
+		stops = append(stops, s.Frame)
+		if v, err := d.EvalFrame(s.Frame, "sq(2)"); err != nil || v != 4 {
+			t.Errorf("%s: expected sq(2) to be 4 in the module, found %d %v", s.Frame.Name, v, err)
+		}
+		return StepIn
+	})
+	if _, err := d.Break("geo.area", "w > 2"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Break("geo.", ""); err == nil {
+		t.Fatalf("Expected an invalid name to fail")
+	}
+	if v, err := d.Eval(nil, "geo.area(1) + geo.area(3)", false); err != nil || v != 12 {
+		t.Fatalf("Expected 12, found %d %v", v, err)
+	}
+	if len(stops) != 2 || stops[0].Name != "geo.area" || stops[1].Name != "sq" {
+		t.Fatalf("Expected to stop at geo.area and step into sq, found %+v", stops)
+	}
+	if w := stops[0].Locals["w"]; w.Value == nil || *w.Value != 3 {
+		t.Errorf("Expected w = 3, found %v", stops[0].Locals)
+	}
+	if x := stops[1].Locals["x"]; x.Value == nil || *x.Value != 3 || stops[1].Line != 1 {
+		t.Errorf("Expected x = 3 in sq of the module on line 1, found %v on line %d", stops[1].Locals, stops[1].Line)
+	}
+}
@@ -0,0 +1,59 @@
+package parser
+
+import "sync"
+
+// Environment is a context that is safe for concurrent use. Changes copy the context
+// and swap it in, so a context returned by Snapshot is never modified afterwards
+type Environment struct {
+	lock sync.RWMutex
+	ctx  Context
+}
+
+// NewEnvironment creates a new environment from a copy of the context
+func NewEnvironment(ctx Context) *Environment {
+	if ctx == nil {
+		ctx = NewContext()
+	}
+	return &Environment{ctx: ctx.Clone()}
+}
+
+// Snapshot returns the current context. It must not be modified
+func (e *Environment) Snapshot() Context {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	return e.ctx
+}
+
+// Get returns the variable with the name
+func (e *Environment) Get(name string) (ContextVar, bool) {
+	v, ok := e.Snapshot()[name]
+	return v, ok
+}
+
+// Set sets the variable with the name
+func (e *Environment) Set(name string, v ContextVar) {
+	e.Update(func(ctx Context) error {
+		ctx[name] = v
+		return nil
+	})
+}
+
+// Delete removes the variable with the name
+func (e *Environment) Delete(name string) {
+	e.Update(func(ctx Context) error {
+		delete(ctx, name)
+		return nil
+	})
+}
+
+// Update calls fn with a copy of the current context and swaps the copy in if fn succeeds
+func (e *Environment) Update(fn func(Context) error) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	ctx := e.ctx.Clone()
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	e.ctx = ctx
+	return nil
+}
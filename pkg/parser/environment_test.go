@@ -0,0 +1,82 @@
+package parser
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestEnvironmentConcurrentDefine evaluates while definitions are added. Run it with -race
+func TestEnvironmentConcurrentDefine(t *testing.T) {
+	r := NewRuntime()
+	if _, err := r.Define("let sq x = x * x"); err != nil {
+		t.Fatal(err)
+	}
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 16)
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 200; n++ {
+				v, err := r.Eval("sq(3) + 1")
+				if err == nil && v != 10 {
+					err = fmt.Errorf("sq(3) + 1 = %d", v)
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 0; n < 200; n++ {
+			if _, err := r.Define(fmt.Sprintf("let f x = sq(x) + %d", n)); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+	if v, err := r.Eval("f(2)"); err != nil || v != 203 {
+		t.Errorf("f(2) = %d, %v", v, err)
+	}
+}
+
+func TestSnapshotIsNotModified(t *testing.T) {
+	r := NewRuntime()
+	before := r.Environment.Snapshot()
+	if _, err := r.Define("let f x = x"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := before["f"]; ok {
+		t.Error("a snapshot taken before Define sees the definition")
+	}
+}
+
+func TestDefineStatements(t *testing.T) {
+	r := NewRuntime()
+	stmts := []Statement{
+		{Source: "let a x = x + 1", Line: 1},
+		{Source: "let b x = a(x) * 2", Line: 2},
+		{Source: "let c x = a(x, x)", Line: 3},
+		{Source: "let d x = x", Line: 4},
+	}
+	fns, err := r.DefineStatements(stmts)
+	if err == nil || len(fns) != 2 {
+		t.Fatalf("expected 2 functions and an error for line 3, got %d, %v", len(fns), err)
+	}
+	if v, err := r.Eval("b(1)"); err != nil || v != 4 {
+		t.Errorf("b(1) = %d, %v", v, err)
+	}
+	if _, ok := r.Environment.Get("d"); ok {
+		t.Error("statements after the failing one are defined")
+	}
+}
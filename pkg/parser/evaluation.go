@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+var (
+	// ErrTimeout is returned when an evaluation passes the deadline of its context
+	ErrTimeout = errors.New("Evaluation timed out")
+	// ErrBudgetExceeded is returned when an evaluation uses more than its limits allow
+	ErrBudgetExceeded = errors.New("Evaluation budget exceeded")
+)
+
+// Limits bounds the work done by an evaluation. Zero values are unlimited
+type Limits struct {
+	// MaxSteps is the maximum number of expressions evaluated
+	MaxSteps int
+	// MaxNodes is the maximum number of expressions allocated
+	MaxNodes int
+	// MaxDepth is the maximum depth of nested function calls, at most maxRecursiveCalls
+	MaxDepth int
+}
+
+// evaluation is the state of a single evaluation. Forks of an evaluation share its
+// counters and workers but track their own call depth
+type evaluation struct {
+	ctx      context.Context
+	limits   Limits
+	counters *counters
+	workers  workers
+	purity   *purity
+	hook     EvalHook
+	depth    int
+}
+
+type counters struct {
+	steps int64
+	nodes int64
+}
+
+func newEvaluation(ctx context.Context, limits Limits) *evaluation {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if limits.MaxDepth <= 0 || limits.MaxDepth > maxRecursiveCalls {
+		limits.MaxDepth = maxRecursiveCalls
+	}
+	return &evaluation{ctx: ctx, limits: limits, counters: &counters{}, purity: newPurity()}
+}
+
+// fork returns a copy of the evaluation to be used on another goroutine
+func (e *evaluation) fork() *evaluation {
+	f := *e
+	return &f
+}
+
+// step counts an evaluation step and checks the context and step budget
+func (e *evaluation) step() error {
+	steps := atomic.AddInt64(&e.counters.steps, 1)
+	if e.limits.MaxSteps > 0 && steps > int64(e.limits.MaxSteps) {
+		return fmt.Errorf("%w: more than %d steps", ErrBudgetExceeded, e.limits.MaxSteps)
+	}
+	if steps%contextCheckInterval == 0 {
+		return e.err()
+	}
+	return nil
+}
+
+// alloc counts an allocated expression and checks the node budget
+func (e *evaluation) alloc(exp *Expression) (*Expression, error) {
+	nodes := atomic.AddInt64(&e.counters.nodes, 1)
+	if e.limits.MaxNodes > 0 && nodes > int64(e.limits.MaxNodes) {
+		return nil, fmt.Errorf("%w: more than %d nodes", ErrBudgetExceeded, e.limits.MaxNodes)
+	}
+	return exp, nil
+}
+
+// enter enters a function call and checks the depth budget
+func (e *evaluation) enter(name string) error {
+	e.depth++
+	if e.depth > e.limits.MaxDepth {
+		return fmt.Errorf("%w: more than %d nested calls in `%s`", ErrBudgetExceeded, e.limits.MaxDepth, name)
+	}
+	return e.err()
+}
+
+func (e *evaluation) exit() {
+	e.depth--
+}
+
+// traceCall reports the function call to the hook, returning a func reporting its result
+func (e *evaluation) traceCall(name string, inputs []ContextVar) func(Value, error) {
+	if e.hook == nil {
+		return func(Value, error) {}
+	}
+	args := make([]Value, 0, len(inputs))
+	for _, input := range inputs {
+		if input.Value != nil {
+			args = append(args, *input.Value)
+		}
+	}
+	depth := e.depth
+	e.hook.Call(depth, name, args)
+	return func(val Value, err error) {
+		e.hook.Return(depth, name, args, val, err)
+	}
+}
+
+func (e *evaluation) branch(cond *Conditional, predicate Value) {
+	if e.hook != nil {
+		e.hook.Branch(e.depth, cond, predicate)
+	}
+}
+
+func (e *evaluation) err() error {
+	err := e.ctx.Err()
+	if err == context.DeadlineExceeded {
+		return fmt.Errorf("%w after %d steps", ErrTimeout, atomic.LoadInt64(&e.counters.steps))
+	}
+	return err
+}
+
+// isAbort returns whether the error should stop the evaluation rather than leave a partial
+// result. Builtins failing for their inputs and divisions by zero stop it, so their errors are shown
+func isAbort(err error) bool {
+	var be *builtinError
+	return errors.Is(err, ErrTimeout) || errors.Is(err, ErrBudgetExceeded) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, ErrDivisionByZero) || errors.As(err, &be)
+}
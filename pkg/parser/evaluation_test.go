@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newCountdown(t *testing.T, limits Limits) *Runtime {
+	t.Helper()
+	r := NewRuntime()
+	r.Limits = limits
+	for _, src := range []string{
+		"let down n = if n = 0 then 0 else down(n + -1) + 1",
+		"let fib n = if n < 2 then n else fib(n + -1) + fib(n + -2)",
+	} {
+		if _, err := r.Define(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return r
+}
+
+func TestBudgets(t *testing.T) {
+	cases := []struct {
+		limits Limits
+		src    string
+		want   Value
+		err    error
+	}{
+		{limits: Limits{MaxSteps: 100}, src: "down(5)", want: 5},
+		{limits: Limits{MaxSteps: 100}, src: "down(50)", err: ErrBudgetExceeded},
+		{limits: Limits{MaxNodes: 100}, src: "1 + 2 + 3", want: 6},
+		{limits: Limits{MaxNodes: 100}, src: "down(50)", err: ErrBudgetExceeded},
+		{limits: Limits{MaxDepth: 10}, src: "down(9)", want: 9},
+		{limits: Limits{MaxDepth: 10}, src: "down(10)", err: ErrBudgetExceeded},
+		// the default depth ends deep recursion before it overflows the stack
+		{src: "down(1000)", want: 1000},
+		{src: "down(1000000)", err: ErrBudgetExceeded},
+		{limits: Limits{MaxDepth: 1 << 30}, src: "down(1000000)", err: ErrBudgetExceeded},
+	}
+	for _, c := range cases {
+		v, err := newCountdown(t, c.limits).Eval(c.src)
+		if c.err != nil {
+			if !errors.Is(err, c.err) {
+				t.Errorf("%s with %+v: expected %v, got %d, %v", c.src, c.limits, c.err, v, err)
+			}
+		} else if err != nil || v != c.want {
+			t.Errorf("%s with %+v: expected %d, got %d, %v", c.src, c.limits, c.want, v, err)
+		}
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	r := newCountdown(t, Limits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := r.EvalContext(ctx, "fib(40)"); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected %v, got %v", ErrTimeout, err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	r := newCountdown(t, Limits{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := r.EvalContext(ctx, "fib(40)"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if _, err := r.CallContext(ctx, "down", 3); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a call with a done context to fail, got %v", err)
+	}
+}
+
+func TestDivisionByZero(t *testing.T) {
+	r := newCountdown(t, Limits{})
+	if _, err := r.Define("let inv x = 10 / x"); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{"1 / 0", "inv(0) + 1", "inv(down(0))"} {
+		if _, err := r.Eval(src); !errors.Is(err, ErrDivisionByZero) {
+			t.Errorf("%s: expected %v, got %v", src, ErrDivisionByZero, err)
+		}
+	}
+	if _, err := r.Explain("inv(0)"); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("expected explain to fail with %v, got %v", ErrDivisionByZero, err)
+	}
+	if v, err := r.Eval("inv(5)"); err != nil || v != 2 {
+		t.Errorf("expected 2, got %d, %v", v, err)
+	}
+}
@@ -0,0 +1,185 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Tree returns the expression as an indented tree with one node per line
+func (exp *Expression) Tree() string {
+	lines := []string{}
+	exp.tree(&lines, 0, "")
+	return strings.Join(lines, "\n")
+}
+
+func (exp *Expression) tree(lines *[]string, depth int, label string) {
+	indent := strings.Repeat("  ", depth)
+	if exp == nil {
+		*lines = append(*lines, indent+label+"<nil>")
+		return
+	}
+	if exp.Negate {
+		*lines = append(*lines, indent+label+"Negate")
+		inner := *exp
+		inner.Negate = false
+		inner.tree(lines, depth+1, "")
+		return
+	}
+	switch {
+	case exp.Val != nil:
+		*lines = append(*lines, fmt.Sprintf("%s%sValue %d", indent, label, *exp.Val))
+	case exp.Symbol != nil:
+		*lines = append(*lines, fmt.Sprintf("%s%sSymbol %s", indent, label, *exp.Symbol))
+	case exp.Conditional != nil:
+		*lines = append(*lines, indent+label+"Conditional")
+		exp.Conditional.Predicate.tree(lines, depth+1, KeywordIf+": ")
+		exp.Conditional.True.tree(lines, depth+1, KeywordThen+": ")
+		exp.Conditional.False.tree(lines, depth+1, KeywordElse+": ")
+	case exp.Functional != nil:
+		*lines = append(*lines, fmt.Sprintf("%s%sFunctional %s", indent, label, exp.Functional.Name))
+		for _, input := range exp.Functional.Inputs {
+			input.tree(lines, depth+1, "")
+		}
+	default:
+		op := ""
+		if exp.Op != nil {
+			op = string(*exp.Op)
+		}
+		*lines = append(*lines, fmt.Sprintf("%s%sOp %s", indent, label, op))
+		exp.Left.tree(lines, depth+1, "")
+		exp.Right.tree(lines, depth+1, "")
+	}
+}
+
+// Explain reduces the expression one rewrite at a time, returning each form it passes
+// through. The first step is the expression itself and the last is as far as it evaluates
+func (exp *Expression) Explain(context Context) ([]*Expression, error) {
+	return exp.explain(newEvaluation(nil, Limits{}), context)
+}
+
+// ExplainContext is Explain within the limits, stopping when ctx is done
+func (exp *Expression) ExplainContext(ctx context.Context, limits Limits, context Context) ([]*Expression, error) {
+	return exp.explain(newEvaluation(ctx, limits), context)
+}
+
+func (exp *Expression) explain(e *evaluation, context Context) ([]*Expression, error) {
+	steps := []*Expression{exp}
+	for len(steps) <= maxExplainSteps {
+		next, ok, err := steps[len(steps)-1].reduce(e, context)
+		if err != nil {
+			return steps, err
+		}
+		if !ok {
+			return steps, nil
+		}
+		steps = append(steps, next)
+	}
+	return steps, fmt.Errorf("Stopped explaining after %d steps", maxExplainSteps)
+}
+
+// reduce rewrites the leftmost innermost reducible part of the expression, returning whether
+// anything was rewritten. A function call with evaluated inputs is rewritten to its result
+func (exp *Expression) reduce(e *evaluation, context Context) (*Expression, bool, error) {
+	if err := e.step(); err != nil {
+		return nil, false, err
+	}
+	if exp.Val != nil {
+		return exp, false, nil
+	}
+	if exp.Symbol != nil {
+		v, ok := context[string(*exp.Symbol)]
+		if ok && v.Value != nil {
+			val := *v.Value
+			if exp.Negate {
+				val = -1 * val
+			}
+			return &Expression{Val: &val}, true, nil
+		}
+		if ok && v.Symbol != nil && *v.Symbol != *exp.Symbol {
+			sym := *v.Symbol
+			return &Expression{Symbol: &sym, Negate: exp.Negate}, true, nil
+		}
+		return exp, false, nil
+	}
+
+	if exp.Conditional != nil {
+		pred, ok, err := exp.Conditional.Predicate.reduce(e, context)
+		if err != nil || ok {
+			cond := &Conditional{Predicate: pred, True: exp.Conditional.True, False: exp.Conditional.False}
+			return &Expression{Conditional: cond}, ok, err
+		}
+		if pred.Val == nil {
+			return exp, false, nil
+		}
+		e.branch(exp.Conditional, valueOf(pred))
+		if valueOf(pred) != 0 {
+			return exp.Conditional.True, true, nil
+		}
+		return exp.Conditional.False, true, nil
+	}
+
+	if exp.Functional != nil {
+		vals := []ContextVar{}
+		for i, input := range exp.Functional.Inputs {
+			next, ok, err := input.reduce(e, context)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				inputs := append([]*Expression{}, exp.Functional.Inputs...)
+				inputs[i] = next
+				return &Expression{Functional: &Functional{Name: exp.Functional.Name, Inputs: inputs}}, true, nil
+			}
+			if input.Val != nil {
+				v := valueOf(input)
+				vals = append(vals, FromValue(&v))
+			}
+		}
+		if len(vals) != len(exp.Functional.Inputs) {
+			return exp, false, nil
+		}
+		v, err := call(e, context, exp.Functional.Name, vals...)
+		if isAbort(err) {
+			return nil, false, err
+		} else if err != nil {
+			return exp, false, nil
+		}
+		return &Expression{Val: &v}, true, nil
+	}
+
+	left, ok, err := exp.Left.reduce(e, context)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return &Expression{Left: left, Op: exp.Op, Right: exp.Right, Negate: exp.Negate}, true, nil
+	}
+	right, ok, err := exp.Right.reduce(e, context)
+	if err != nil {
+		return nil, false, err
+	}
+	if ok {
+		return &Expression{Left: exp.Left, Op: exp.Op, Right: right, Negate: exp.Negate}, true, nil
+	}
+	if exp.Left.Val == nil || exp.Right.Val == nil {
+		return exp, false, nil
+	}
+	v, err := exp.Op.Evaluate(valueOf(exp.Left), valueOf(exp.Right))
+	if err != nil {
+		return nil, false, err
+	}
+	if exp.Negate {
+		v = -1 * v
+	}
+	return &Expression{Val: &v}, true, nil
+}
+
+// valueOf returns the value of a value expression, applying its negation
+func valueOf(exp *Expression) Value {
+	v := *exp.Val
+	if exp.Negate {
+		v = -1 * v
+	}
+	return v
+}
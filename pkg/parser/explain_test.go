@@ -0,0 +1,41 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplain(t *testing.T) {
+	r := NewRuntime()
+	if _, err := r.Define("let f x = x * 3"); err != nil {
+		t.Fatal(err)
+	}
+	for src, want := range map[string][]string{
+		"if 2 > 1 then 3 + 4 else 0":   {"if 2>1 then 3+4 else 0", "if 1 then 3+4 else 0", "3+4", "7"},
+		"f(1 + 1) - 1":                 {"f(1+1)-1", "f(2)-1", "6-1", "5"},
+		"if f(1) = 3 then f(2) else 0": {"if f(1)=3 then f(2) else 0", "if 3=3 then f(2) else 0", "if 1 then f(2) else 0", "f(2)", "6"},
+	} {
+		steps, err := r.Explain(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := []string{}
+		for _, step := range steps {
+			found = append(found, step.String())
+		}
+		if strings.Join(found, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: expected the steps %q, found %q", src, want, found)
+		}
+	}
+}
+
+func TestExplainStops(t *testing.T) {
+	// each addition is one step
+	steps, err := NewRuntime().Explain(strings.Repeat("1 + ", maxExplainSteps+10) + "1")
+	if err == nil || !strings.Contains(err.Error(), "Stopped explaining") {
+		t.Fatalf("Expected explaining to stop, found %v", err)
+	}
+	if len(steps) != maxExplainSteps+1 {
+		t.Errorf("Expected %d steps, found %d", maxExplainSteps+1, len(steps))
+	}
+}
@@ -21,6 +21,9 @@ type Expression struct {
 
 	Conditional *Conditional
 	Functional  *Functional
+
+	// Index is the index of the expression, or of its operator, in the source it was parsed from
+	Index int
 }
 
 // Functional is a function call expression
@@ -75,8 +78,20 @@ func (exp *Expression) String() string {
 	return str
 }
 
-// Evaluate evaluates the expression with the given context
+// Evaluate evaluates the expression with the given context. If the evaluation is
+// aborted the expression is returned unevaluated
 func (exp *Expression) Evaluate(context Context) *Expression {
+	ret, err := exp.eval(newEvaluation(nil, Limits{}), context)
+	if err != nil {
+		return exp
+	}
+	return ret
+}
+
+func (exp *Expression) eval(e *evaluation, context Context) (*Expression, error) {
+	if err := e.step(); err != nil {
+		return nil, err
+	}
 	if exp.Val != nil {
 		u := *exp.Val
 		v := int(u)
@@ -84,7 +99,7 @@ func (exp *Expression) Evaluate(context Context) *Expression {
 		if exp.Negate {
 			val = -1 * val
 		}
-		return &Expression{Val: &val}
+		return e.alloc(&Expression{Val: &val})
 	}
 	if exp.Symbol != nil {
 		if v, ok := context[string(*exp.Symbol)]; ok {
@@ -93,45 +108,56 @@ func (exp *Expression) Evaluate(context Context) *Expression {
 				if exp.Negate {
 					val = -1 * val
 				}
-				return &Expression{Val: &val}
+				return e.alloc(&Expression{Val: &val})
 			}
 			if v.Symbol != nil {
 				sym := Symbol(*v.Symbol)
-				return &Expression{Symbol: &sym, Negate: exp.Negate}
+				return e.alloc(&Expression{Symbol: &sym, Negate: exp.Negate})
 			}
 		}
 		s := string(*exp.Symbol)
 		sy := Symbol(s)
-		return &Expression{Symbol: &sy, Negate: exp.Negate}
+		return e.alloc(&Expression{Symbol: &sy, Negate: exp.Negate})
 	}
 
 	if exp.Conditional != nil {
-		pred := exp.Conditional.Predicate.Evaluate(context)
+		pred, err := exp.Conditional.Predicate.eval(e, context)
+		if err != nil {
+			return nil, err
+		}
 		if pred.Val != nil {
 			v := int(*pred.Val)
+			e.branch(exp.Conditional, Value(v))
 			if v != 0 {
-				return exp.Conditional.True.Evaluate(context)
+				return exp.Conditional.True.eval(e, context)
 			}
-			return exp.Conditional.False.Evaluate(context)
+			return exp.Conditional.False.eval(e, context)
+		}
+		cond := &Conditional{
+			Predicate: pred,
+			True:      exp.Conditional.True,
+			False:     exp.Conditional.False,
 		}
+		return e.alloc(&Expression{Conditional: cond})
 	}
 
 	if exp.Functional != nil {
-		fn, ok := context[exp.Functional.Name]
-		inputs := []*Expression{}
+		inputs, err := evalAll(e, context, exp.Functional.Inputs)
+		if err != nil {
+			return nil, err
+		}
 		vals := []ContextVar{}
-		for _, arg := range exp.Functional.Inputs {
-			input := arg.Evaluate(context)
-			inputs = append(inputs, input)
+		for _, input := range inputs {
 			if input.Val != nil {
 				vals = append(vals, FromValue(input.Val))
 			}
 		}
-		if len(vals) == len(inputs) && ok {
-			val, err := fn.Evaluate(context, vals...)
+		if len(vals) == len(inputs) {
+			v, err := call(e, context, exp.Functional.Name, vals...)
 			if err == nil {
-				v := Value(val)
-				return &Expression{Val: &v}
+				return e.alloc(&Expression{Val: &v})
+			} else if isAbort(err) {
+				return nil, err
 			}
 		}
 		fu := &Functional{
@@ -139,24 +165,71 @@ func (exp *Expression) Evaluate(context Context) *Expression {
 			Inputs: inputs,
 		}
 		// partial eval
-		return &Expression{Functional: fu}
+		return e.alloc(&Expression{Functional: fu})
 	}
 
-	l := exp.Left.Evaluate(context)
-	r := exp.Right.Evaluate(context)
+	var l, r *Expression
+	var err error
+	if e.split(context, exp.Left, exp.Right) {
+		err = e.parallel(
+			func(e *evaluation) (err error) {
+				l, err = exp.Left.eval(e, context)
+				return err
+			},
+			func(e *evaluation) (err error) {
+				r, err = exp.Right.eval(e, context)
+				return err
+			},
+		)
+	} else if l, err = exp.Left.eval(e, context); err == nil {
+		r, err = exp.Right.eval(e, context)
+	}
+	if err != nil {
+		return nil, err
+	}
 	o := *exp.Op
 	if l.Val != nil && r.Val != nil {
 		lv := *l.Val
 		rv := *r.Val
-		v := o.Evaluate(lv, rv)
+		v, err := o.Evaluate(lv, rv)
+		if err != nil {
+			return nil, err
+		}
 		if exp.Negate {
 			v = -1 * v
 		}
-		return &Expression{Val: &v}
+		return e.alloc(&Expression{Val: &v})
 	}
 
 	op := Operator(string(o))
-	return &Expression{Left: l, Right: r, Op: &op, Negate: exp.Negate}
+	return e.alloc(&Expression{Left: l, Right: r, Op: &op, Negate: exp.Negate})
+}
+
+// evalAll evaluates each of the expressions, in parallel if the evaluation allows it
+func evalAll(e *evaluation, context Context, exps []*Expression) ([]*Expression, error) {
+	ret := make([]*Expression, len(exps))
+	if !e.split(context, exps...) {
+		for i, exp := range exps {
+			r, err := exp.eval(e, context)
+			if err != nil {
+				return nil, err
+			}
+			ret[i] = r
+		}
+		return ret, nil
+	}
+	fns := make([]func(*evaluation) error, 0, len(exps))
+	for i, exp := range exps {
+		i, exp := i, exp
+		fns = append(fns, func(e *evaluation) (err error) {
+			ret[i], err = exp.eval(e, context)
+			return err
+		})
+	}
+	if err := e.parallel(fns...); err != nil {
+		return nil, err
+	}
+	return ret, nil
 }
 
 func buildTable(exp *Expression, table SymbolTable) {
@@ -222,7 +295,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 				}
 				i = i + close // skip ahead
 				state = 1     // we have the left expression, parse the right expression
-			} else if unicode.IsLetter(r) {
+			} else if IsIdentifierRune(r) {
 				// this is a letter, making it a symbol
 				exp, idx, err := parseSymbol(runes[i:], i+startIdx)
 				if err != nil {
@@ -279,7 +352,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 					return nil, -1, err
 				}
 				l := left
-				left = &Expression{}
+				left = &Expression{Index: startIdx + i}
 				left.Left = l
 				left.Right = next
 				left.Op = times()
@@ -295,6 +368,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 				full.Op = toOp(r)
 				full.Left = left
 				full.Right = right
+				full.Index = startIdx + i
 				return full, len(runes), nil
 			} else if r == '-' {
 				nidx := i + 1
@@ -307,7 +381,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 				}
 				next.Negate = true
 				l := left
-				left = &Expression{}
+				left = &Expression{Index: startIdx + i}
 				left.Left = l
 				left.Right = next
 				left.Op = plus()
@@ -323,7 +397,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 					return nil, -1, err
 				}
 				l := left
-				left = &Expression{}
+				left = &Expression{Index: startIdx + i}
 				left.Left = l
 				left.Right = next
 				left.Op = toOp(r)
@@ -338,9 +412,9 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 				// value done
 				i = i - 1
 				state = 1
-			} else if unicode.IsLetter(r) {
+			} else if IsIdentifierRune(r) {
 				// symbol value exp i.e 2x
-				l := &Expression{}
+				l := &Expression{Index: left.Index}
 				l.Val = left.Val
 				r, idx, err := parseSymbol(runes[i:], i+startIdx)
 				if err != nil {
@@ -370,7 +444,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 					return nil, -1, err
 				}
 				f.Name = string(*left.Symbol)
-				left = &Expression{Functional: f}
+				left = &Expression{Functional: f, Index: left.Index}
 				i = i + close
 				state = 1
 			} else {
@@ -385,6 +459,7 @@ func parse(runes []rune, startIdx int, onlyFirst bool) (*Expression, int, error)
 
 func parseFunctionalArgs(runes []rune, startIdx int) (*Functional, error) {
 	args := [][]rune{}
+	starts := []int{}
 	idx := 0
 	for i, r := range runes {
 		if r == ',' {
@@ -393,6 +468,7 @@ func parseFunctionalArgs(runes []rune, startIdx int) (*Functional, error) {
 				return nil, fmt.Errorf("Empty argument given at index %d", startIdx+i)
 			}
 			args = append(args, arg)
+			starts = append(starts, idx)
 			idx = i + 1
 		} else if r == '(' {
 			close := findParens(runes[i:])
@@ -402,11 +478,12 @@ func parseFunctionalArgs(runes []rune, startIdx int) (*Functional, error) {
 
 	if idx < len(runes) && len(runes[idx:]) > 0 {
 		args = append(args, runes[idx:])
+		starts = append(starts, idx)
 	}
 	inputs := make([]*Expression, 0, len(args))
 
-	for _, arg := range args {
-		exp, _, err := parse(arg, startIdx, false)
+	for i, arg := range args {
+		exp, _, err := parse(arg, startIdx+starts[i], false)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,273 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Format formats the source canonically. Each statement is written on one line with as few
+// parentheses as parse the same way and spaces around operators, and long if/then/else chains
+// are broken before each else. Runs of empty lines become one empty line, and lines starting
+// with `:`, such as interpreter commands, are kept as they are. Comments on lines of their own
+// are kept, and comments within a statement are moved to the end of it. A statement is only
+// rewritten if it parses back the same way, so formatting never changes what the source evaluates to
+func Format(src string) (string, error) {
+	stmts, err := readStatements(strings.NewReader(src), true)
+	if err != nil {
+		return "", err
+	}
+	lines := []string{}
+	end := 0
+	for i, stmt := range stmts {
+		if i > 0 && stmt.Line > end+1 {
+			lines = append(lines, "")
+		}
+		end = stmt.EndLine
+		if isComment(stmt.Source) {
+			for _, line := range stmt.lines {
+				lines = append(lines, strings.TrimSpace(line))
+			}
+			continue
+		}
+		formatted, err := formatStatement(stmt.Source)
+		if err != nil {
+			return "", fmt.Errorf("Line %d: %v", stmt.Line, err)
+		}
+		lines = append(lines, formatted)
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func formatStatement(src string) (string, error) {
+	if strings.HasPrefix(src, ":") || IsImport(src) || IsModuleDeclaration(src) {
+		return src, nil
+	}
+	code, err := formatCode(src)
+	if err != nil || code == src {
+		return code, err
+	}
+	if comments := rawComments(src); len(comments) > 0 {
+		code += " " + strings.Join(comments, " ")
+	}
+	return code, nil
+}
+
+// formatCode formats the statement without its comments, or returns the source if the
+// formatted statement does not parse the same way
+func formatCode(src string) (string, error) {
+	prefix := ""
+	var root *Expression
+	if IsDefinition(src) {
+		f, err := parseDefinition(src)
+		if err != nil {
+			return "", err
+		}
+		prefix = f.declarationPrefix()
+		root = f.Body.Root
+	} else {
+		a, err := Parse(src)
+		if err != nil {
+			return "", err
+		}
+		root = a.Root
+	}
+	fm := newFormatter()
+	line := prefix + fm.render(root)
+	if len([]rune(line)) > formatLineWidth && root.Conditional != nil && !root.Negate {
+		if broken := prefix + fm.chain(root); sameStatement(src, broken) {
+			return broken, nil
+		}
+	}
+	if !sameStatement(src, line) {
+		return src, nil
+	}
+	return line, nil
+}
+
+// sameStatement returns whether the formatted statement is read as one statement that parses
+// the same way as the source
+func sameStatement(src, formatted string) bool {
+	stmts, err := ReadStatements(strings.NewReader(formatted))
+	if err != nil || len(stmts) != 1 {
+		return false
+	}
+	formatted = stmts[0].Source
+	if IsDefinition(src) != IsDefinition(formatted) {
+		return false
+	}
+	if IsDefinition(src) {
+		f1, err1 := parseDefinition(src)
+		f2, err2 := parseDefinition(formatted)
+		return err1 == nil && err2 == nil && f1.declarationPrefix() == f2.declarationPrefix() && equalExpressions(f1.Body.Root, f2.Body.Root)
+	}
+	a1, err1 := Parse(src)
+	a2, err2 := Parse(formatted)
+	return err1 == nil && err2 == nil && equalExpressions(a1.Root, a2.Root)
+}
+
+// parseDefinition parses the definition without checking that the body only uses the inputs
+func parseDefinition(src string) (*Function, error) {
+	f, err := parseLetFunction(src, NewContext())
+	if f != nil && f.Body != nil {
+		return f, nil
+	}
+	return nil, err
+}
+
+// declarationPrefix returns the declaration up to the body, as in `let f x y = `
+func (f *Function) declarationPrefix() string {
+	parts := []string{KeywordLet}
+	if f.Name != nil {
+		parts = append(parts, *f.Name)
+	}
+	parts = append(parts, f.Inputs...)
+	return strings.Join(parts, " ") + " = "
+}
+
+// formatter renders expressions with as few parentheses as parse back to the same expression
+type formatter struct {
+	full map[*Expression]string
+	bare map[*Expression]string
+}
+
+func newFormatter() *formatter {
+	return &formatter{full: make(map[*Expression]string), bare: make(map[*Expression]string)}
+}
+
+// render renders the expression
+func (fm *formatter) render(exp *Expression) string {
+	if exp == nil {
+		return ""
+	}
+	if s, ok := fm.full[exp]; ok {
+		return s
+	}
+	s := fm.renderBare(exp)
+	if exp.Negate && exp.Conditional != nil {
+		s = fm.pick(exp, "-("+s+")")
+	} else if exp.Negate {
+		s = fm.pick(exp, "-"+s, "-("+s+")")
+	}
+	fm.full[exp] = s
+	return s
+}
+
+// renderBare renders the expression without its negation
+func (fm *formatter) renderBare(exp *Expression) string {
+	if s, ok := fm.bare[exp]; ok {
+		return s
+	}
+	bare := *exp
+	bare.Negate = false
+	s := ""
+	switch {
+	case exp.Val != nil:
+		s = strconv.Itoa(int(*exp.Val))
+	case exp.Symbol != nil:
+		s = string(*exp.Symbol)
+	case exp.Functional != nil:
+		args := make([]string, 0, len(exp.Functional.Inputs))
+		for _, input := range exp.Functional.Inputs {
+			args = append(args, fm.render(input))
+		}
+		s = exp.Functional.Name + "(" + strings.Join(args, ", ") + ")"
+	case exp.Conditional != nil:
+		p := fm.render(exp.Conditional.Predicate)
+		t := fm.render(exp.Conditional.True)
+		f := fm.render(exp.Conditional.False)
+		s = fm.pick(&bare,
+			fmt.Sprintf("%s %s %s %s %s %s", KeywordIf, p, KeywordThen, t, KeywordElse, f),
+			fmt.Sprintf("%s (%s) %s (%s) %s (%s)", KeywordIf, p, KeywordThen, t, KeywordElse, f),
+		)
+	default:
+		l := fm.render(exp.Left)
+		r := fm.render(exp.Right)
+		op := " " + string(*exp.Op) + " "
+		candidates := []string{}
+		if exp.Op.Equal(plus()) && exp.Right != nil && exp.Right.Negate {
+			candidates = append(candidates, operands(l, " - ", fm.renderBare(exp.Right))...)
+		}
+		s = fm.pick(&bare, append(candidates, operands(l, op, r)...)...)
+	}
+	fm.bare[exp] = s
+	return s
+}
+
+// chain renders a conditional with each else of its chain on a new line
+func (fm *formatter) chain(exp *Expression) string {
+	lines := []string{}
+	for exp.Conditional != nil && !exp.Negate {
+		p := fm.render(exp.Conditional.Predicate)
+		t := fm.render(exp.Conditional.True)
+		line := fmt.Sprintf("%s %s %s %s", KeywordIf, p, KeywordThen, t)
+		if len(lines) > 0 {
+			line = KeywordElse + " " + line
+		}
+		lines = append(lines, line)
+		exp = exp.Conditional.False
+	}
+	lines = append(lines, KeywordElse+" "+fm.render(exp))
+	return strings.Join(lines, "\n"+formatIndent)
+}
+
+// pick returns the first candidate that parses to the expression, or the last candidate
+func (fm *formatter) pick(exp *Expression, candidates ...string) string {
+	for _, c := range candidates {
+		if a, err := Parse(c); err == nil && equalExpressions(a.Root, exp) {
+			return c
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// operands returns the ways of joining the operands with the operator, from fewest parentheses to most
+func operands(l, op, r string) []string {
+	return []string{
+		l + op + r,
+		"(" + l + ")" + op + r,
+		l + op + "(" + r + ")",
+		"(" + l + ")" + op + "(" + r + ")",
+	}
+}
+
+// equalExpressions returns whether the expressions have the same structure
+func equalExpressions(a, b *Expression) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	if a.Negate != b.Negate {
+		return false
+	}
+	switch {
+	case a.Val != nil:
+		return b.Val != nil && *a.Val == *b.Val
+	case a.Symbol != nil:
+		return b.Symbol != nil && *a.Symbol == *b.Symbol
+	case a.Functional != nil:
+		if b.Functional == nil || a.Functional.Name != b.Functional.Name || len(a.Functional.Inputs) != len(b.Functional.Inputs) {
+			return false
+		}
+		for i := range a.Functional.Inputs {
+			if !equalExpressions(a.Functional.Inputs[i], b.Functional.Inputs[i]) {
+				return false
+			}
+		}
+		return true
+	case a.Conditional != nil:
+		return b.Conditional != nil &&
+			equalExpressions(a.Conditional.Predicate, b.Conditional.Predicate) &&
+			equalExpressions(a.Conditional.True, b.Conditional.True) &&
+			equalExpressions(a.Conditional.False, b.Conditional.False)
+	}
+	if b.Val != nil || b.Symbol != nil || b.Functional != nil || b.Conditional != nil {
+		return false
+	}
+	if a.Op == nil || b.Op == nil || !a.Op.Equal(b.Op) {
+		return false
+	}
+	return equalExpressions(a.Left, b.Left) && equalExpressions(a.Right, b.Right)
+}
@@ -0,0 +1,73 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// results defines the `let` statements of the source and evaluates its expressions in order,
+// returning the result or error of each
+func results(t *testing.T, src string) []string {
+	t.Helper()
+	stmts, err := ReadStatements(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := NewRuntime()
+	ret := []string{}
+	for _, stmt := range stmts {
+		if strings.HasPrefix(stmt.Source, ":") {
+			continue
+		} else if IsDefinition(stmt.Source) {
+			if _, err := r.DefineStatement(stmt); err != nil {
+				ret = append(ret, err.Error())
+			}
+			continue
+		}
+		v, err := r.Eval(stmt.Source)
+		ret = append(ret, fmt.Sprintf("%d %v", v, err))
+	}
+	return ret
+}
+
+func TestFormat(t *testing.T) {
+	cases := []struct {
+		src, want string
+	}{
+		{
+			src:  "let f x=((x+1))*2 // doubles\n\n\n// next\nlet g x = if x>1 then if x>2 then 3 else 2 else 1\nf(2)+g(3)\n",
+			want: "let f x = (x + 1) * 2 // doubles\n\n// next\nlet g x = if x > 1 then if x > 2 then 3 else 2 else 1\nf(2) + g(3)\n",
+		},
+		{
+			src:  "let sign x = if x > 0 then 1 else if x = 0 then 0 else if x < -100 then -2 else -1\nsign(-5) + sign(0) * 10 + sign(7) * 100 + sign(-500)*1000\n",
+			want: "let sign x = if x > 0 then 1\n  else if x = 0 then 0\n  else if x < -100 then -2\n  else -1\nsign(-5) + sign(0) * 10 + sign(7) * 100 + sign(-500) * 1000\n",
+		},
+		{
+			src:  "let a x = x /* inner */ + 1\n/* block\ncomment */\n:help\n2 ^ (1 + 1) * -(3)\n(a(1))*(a(2))\n",
+			want: "let a x = x + 1 /* inner */\n/* block\ncomment */\n:help\n2 ^ (1 + 1) * -3\na(1) * a(2)\n",
+		},
+		{
+			src: "let longname_function first_input second_input = if first_input > second_input then first_input * second_input + 1000000 else second_input * first_input + 2000000\nlongname_function(3, 2)\n",
+			want: "let longname_function first_input second_input = if first_input > second_input then first_input * second_input + 1000000\n" +
+				"  else second_input * first_input + 2000000\nlongname_function(3, 2)\n",
+		},
+	}
+	for _, c := range cases {
+		formatted, err := Format(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if formatted != c.want {
+			t.Errorf("Expected\n%s\nfound\n%s", c.want, formatted)
+		}
+		again, err := Format(formatted)
+		if err != nil || again != formatted {
+			t.Errorf("Expected formatting to be idempotent, found\n%s\nthen\n%s %v", formatted, again, err)
+		}
+		want, found := results(t, c.src), results(t, formatted)
+		if strings.Join(want, "\n") != strings.Join(found, "\n") {
+			t.Errorf("Expected the formatted source to evaluate to %v, found %v", want, found)
+		}
+	}
+}
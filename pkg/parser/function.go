@@ -1,6 +1,7 @@
 package parser
 
 import (
+	gocontext "context"
 	"fmt"
 	"strings"
 	"unicode"
@@ -11,6 +12,13 @@ type Function struct {
 	Name   *string
 	Body   *AST
 	Inputs []string
+	// Line is the line of the source file the function was defined on, or 0
+	Line int
+	// Doc is the text of the comments before the definition
+	Doc string
+	// Scope is the context of the module the function was imported from, which calls in the
+	// body are resolved in, or nil
+	Scope Context
 }
 
 // FunctionCall is a function call
@@ -32,11 +40,20 @@ func (f *Function) mapInputs(inputs ...ContextVar) (map[string]ContextVar, error
 
 // Evaluate fully evaluates the function, and errors otherwise
 func (f *Function) Evaluate(context map[string]ContextVar, inputs ...ContextVar) (int, error) {
+	return f.evaluate(newEvaluation(nil, Limits{}), context, inputs...)
+}
+
+// EvaluateContext fully evaluates the function within the limits, stopping when ctx is done
+func (f *Function) EvaluateContext(ctx gocontext.Context, limits Limits, context map[string]ContextVar, inputs ...ContextVar) (int, error) {
+	return f.evaluate(newEvaluation(ctx, limits), context, inputs...)
+}
+
+func (f *Function) evaluate(e *evaluation, context map[string]ContextVar, inputs ...ContextVar) (int, error) {
 	local, err := f.mapInputs(inputs...)
 	if err != nil {
 		return -1, err
 	}
-	return f.Body.EvaluateFull(StitchContext(local, context))
+	return f.Body.evaluateFull(e, StitchContext(local, context))
 }
 
 // PartialEval partially evaluates the function into another function
@@ -64,18 +81,56 @@ func (f *Function) Declaration() string {
 	if f.Name == nil {
 		return ""
 	}
-	args := strings.Join(f.Inputs, " ")
-	body := f.Body.String()
-	return fmt.Sprintf("%s %s %s = %s", KeywordLet, *f.Name, args, body)
+	return f.declarationPrefix() + newFormatter().render(f.Body.Root)
+}
+
+// calls returns the names of the functions the function calls, in the order they first appear
+func (f *Function) calls() []string {
+	ret := []string{}
+	seen := map[string]bool{}
+	var walk func(exp *Expression)
+	walk = func(exp *Expression) {
+		if exp == nil {
+			return
+		}
+		if exp.Functional != nil {
+			if !seen[exp.Functional.Name] {
+				seen[exp.Functional.Name] = true
+				ret = append(ret, exp.Functional.Name)
+			}
+			for _, input := range exp.Functional.Inputs {
+				walk(input)
+			}
+		}
+		if exp.Conditional != nil {
+			walk(exp.Conditional.Predicate)
+			walk(exp.Conditional.True)
+			walk(exp.Conditional.False)
+		}
+		walk(exp.Left)
+		walk(exp.Right)
+	}
+	if f.Body != nil {
+		walk(f.Body.Root)
+	}
+	return ret
 }
 
-// ParseFunction parses the input string as a function
+// ParseFunction parses the input string as a function and infers its type, with calls
+// resolved in the context
 func ParseFunction(input string, context map[string]ContextVar) (*Function, error) {
-	return parseLetFunction(input, context)
+	f, err := parseLetFunction(input, context)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Context(context).Infer(f); err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 func parseLetFunction(input string, context map[string]ContextVar) (*Function, error) {
-	runes := []rune(input)
+	runes := []rune(StripComments(input))
 	if len(runes) < 5 {
 		return nil, fmt.Errorf("Not enough chars for function definition")
 	}
@@ -117,7 +172,7 @@ func parseLetFunction(input string, context map[string]ContextVar) (*Function, e
 		case 4:
 			if unicode.IsSpace(r) {
 				continue
-			} else if unicode.IsLetter(r) {
+			} else if IsIdentifierRune(r) {
 				name, idx, err := parseFunctionName(runes[i:], i)
 				if err != nil {
 					return nil, err
@@ -131,7 +186,7 @@ func parseLetFunction(input string, context map[string]ContextVar) (*Function, e
 		case 5:
 			if unicode.IsSpace(r) {
 				continue
-			} else if unicode.IsLetter(r) {
+			} else if IsIdentifierRune(r) {
 				symbol, idx, err := parseSymbol(runes[i:], i)
 				if err != nil {
 					return nil, err
@@ -144,11 +199,12 @@ func parseLetFunction(input string, context map[string]ContextVar) (*Function, e
 				order = append(order, arg)
 				i = i + idx - 1
 			} else if r == '=' {
-				body, err := Parse(string(runes[i+1:]))
+				// the body is parsed in place so indices in it are indices in the definition
+				body, _, err := parse(runes[i+1:], i+1, false)
 				if err != nil {
 					return nil, err
 				}
-				f.Body = body
+				f.Body = newAST(body)
 				i = len(runes)
 				break
 			} else {
@@ -169,7 +225,7 @@ func parseFunctionName(runes []rune, startIdx int) (string, int, error) {
 	idx := 0
 	for i, r := range runes {
 		idx = i
-		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+		if IsIdentifierRune(r) || unicode.IsDigit(r) {
 			continue
 		} else if unicode.IsSpace(r) {
 			break
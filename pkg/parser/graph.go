@@ -0,0 +1,248 @@
+package parser
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// GraphFormat is a text format for graphs
+type GraphFormat string
+
+const (
+	// GraphDOT is the Graphviz DOT format
+	GraphDOT GraphFormat = "dot"
+	// GraphMermaid is the Mermaid flowchart format
+	GraphMermaid GraphFormat = "mermaid"
+)
+
+// nodeShape is how a node of a graph is drawn
+type nodeShape int
+
+const (
+	shapeDefault nodeShape = iota
+	shapeBox
+	shapeDashed
+)
+
+type graphNode struct {
+	label string
+	shape nodeShape
+}
+
+type graphEdge struct {
+	from, to int
+	label    string
+}
+
+// graph is a directed graph with nodes numbered in order of creation
+type graph struct {
+	nodes []graphNode
+	edges []graphEdge
+}
+
+func (g *graph) node(label string, shape nodeShape) int {
+	g.nodes = append(g.nodes, graphNode{label: label, shape: shape})
+	return len(g.nodes) - 1
+}
+
+func (g *graph) edge(from, to int, label string) {
+	g.edges = append(g.edges, graphEdge{from: from, to: to, label: label})
+}
+
+// Graph returns the tree of the expression in the format, with the nodes of Tree
+func (exp *Expression) Graph(format GraphFormat) (string, error) {
+	g := &graph{}
+	exp.graph(g)
+	return g.render(format)
+}
+
+// graph adds the expression to the graph, returning its node
+func (exp *Expression) graph(g *graph) int {
+	if exp == nil {
+		return g.node("<nil>", shapeDashed)
+	}
+	if exp.Negate {
+		n := g.node("Negate", shapeDefault)
+		inner := *exp
+		inner.Negate = false
+		g.edge(n, inner.graph(g), "")
+		return n
+	}
+	switch {
+	case exp.Val != nil:
+		return g.node(fmt.Sprintf("Value %d", *exp.Val), shapeBox)
+	case exp.Symbol != nil:
+		return g.node(fmt.Sprintf("Symbol %s", *exp.Symbol), shapeBox)
+	case exp.Conditional != nil:
+		n := g.node("Conditional", shapeDefault)
+		g.edge(n, exp.Conditional.Predicate.graph(g), KeywordIf)
+		g.edge(n, exp.Conditional.True.graph(g), KeywordThen)
+		g.edge(n, exp.Conditional.False.graph(g), KeywordElse)
+		return n
+	case exp.Functional != nil:
+		n := g.node("Functional "+exp.Functional.Name, shapeDefault)
+		for _, input := range exp.Functional.Inputs {
+			g.edge(n, input.graph(g), "")
+		}
+		return n
+	}
+	op := ""
+	if exp.Op != nil {
+		op = string(*exp.Op)
+	}
+	n := g.node("Op "+op, shapeDefault)
+	g.edge(n, exp.Left.graph(g), "")
+	g.edge(n, exp.Right.graph(g), "")
+	return n
+}
+
+// CallGraph returns the graph of which functions in the context call which in the format.
+// Builtins are drawn as boxes, and functions that are not defined are dashed. Calls made by an
+// imported function go to the functions of its module, under the names they are imported as,
+// or qualified by the module if they are not imported
+func (c Context) CallGraph(format GraphFormat) (string, error) {
+	return c.callGraph().render(format)
+}
+
+func (c Context) callGraph() *graph {
+	names := []string{}
+	for name, v := range c {
+		if v.Function != nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	g := &graph{}
+	nodes := map[string]int{}
+	node := func(name string, shape nodeShape) int {
+		if n, ok := nodes[name]; ok {
+			return n
+		}
+		nodes[name] = g.node(name, shape)
+		return nodes[name]
+	}
+	modules := moduleNames(c, names)
+	for _, name := range names {
+		node(name, shapeDefault)
+	}
+	for _, name := range names {
+		f := c[name].Function
+		for _, callee := range f.calls() {
+			target, scope := callee, c
+			if f.Scope != nil {
+				// calls of an imported function are made in the context of its module
+				scope = f.Scope
+				if v, ok := scope[callee]; ok && v.Function != nil {
+					target = importedName(c, names, v.Function)
+					if len(target) == 0 {
+						target = modules[contextID(scope)] + QualifierSeparator + callee
+					}
+				}
+			}
+			g.edge(nodes[name], node(target, shapeOf(callee, scope)), "")
+		}
+	}
+	return g
+}
+
+// moduleNames names the module of each scope of the imported functions, by the qualifier
+// the module is imported with, or else as the module of its first imported function
+func moduleNames(c Context, names []string) map[uintptr]string {
+	ret := map[uintptr]string{}
+	for _, name := range names {
+		f := c[name].Function
+		if f.Scope == nil {
+			continue
+		}
+		id := contextID(f.Scope)
+		if i := strings.LastIndex(name, QualifierSeparator); i >= 0 {
+			ret[id] = name[:i]
+		} else if _, ok := ret[id]; !ok {
+			ret[id] = fmt.Sprintf("(module of %s)", name)
+		}
+	}
+	return ret
+}
+
+// importedName returns the name the function of a module is imported as, or an empty string
+// if it is not imported. Qualified imports copy the function, keeping its body
+func importedName(c Context, names []string, f *Function) string {
+	for _, name := range names {
+		if v := c[name].Function; v == f || v.Body == f.Body {
+			return name
+		}
+	}
+	return ""
+}
+
+// contextID identifies the context, as contexts are maps that cannot be compared
+func contextID(c Context) uintptr {
+	return reflect.ValueOf(c).Pointer()
+}
+
+// shapeOf returns the shape of the function with the name in the context
+func shapeOf(name string, c Context) nodeShape {
+	if v, ok := c[name]; ok && v.Function != nil {
+		return shapeDefault
+	} else if c.IsBuiltin(name) {
+		return shapeBox
+	}
+	return shapeDashed
+}
+
+func (g *graph) render(format GraphFormat) (string, error) {
+	switch format {
+	case GraphDOT:
+		return g.dot(), nil
+	case GraphMermaid:
+		return g.mermaid(), nil
+	}
+	return "", fmt.Errorf("Unknown graph format `%s`. Formats are %s and %s", format, GraphDOT, GraphMermaid)
+}
+
+func (g *graph) dot() string {
+	lines := []string{"digraph {"}
+	for i, n := range g.nodes {
+		attrs := fmt.Sprintf("label=%q", n.label)
+		switch n.shape {
+		case shapeBox:
+			attrs += ", shape=box"
+		case shapeDashed:
+			attrs += ", style=dashed"
+		}
+		lines = append(lines, fmt.Sprintf("  n%d [%s];", i, attrs))
+	}
+	for _, e := range g.edges {
+		line := fmt.Sprintf("  n%d -> n%d", e.from, e.to)
+		if len(e.label) > 0 {
+			line += fmt.Sprintf(" [label=%q]", e.label)
+		}
+		lines = append(lines, line+";")
+	}
+	return strings.Join(append(lines, "}"), "\n")
+}
+
+func (g *graph) mermaid() string {
+	lines := []string{"flowchart TD"}
+	for i, n := range g.nodes {
+		label := strings.Replace(n.label, "\"", "#quot;", -1)
+		switch n.shape {
+		case shapeBox:
+			lines = append(lines, fmt.Sprintf("  n%d[\"%s\"]", i, label))
+		case shapeDashed:
+			lines = append(lines, fmt.Sprintf("  n%d{{\"%s\"}}", i, label))
+		default:
+			lines = append(lines, fmt.Sprintf("  n%d([\"%s\"])", i, label))
+		}
+	}
+	for _, e := range g.edges {
+		if len(e.label) > 0 {
+			lines = append(lines, fmt.Sprintf("  n%d -->|%s| n%d", e.from, e.label, e.to))
+		} else {
+			lines = append(lines, fmt.Sprintf("  n%d --> n%d", e.from, e.to))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// calls returns the edges of the graph as caller -> callee labels, sorted
+func (g *graph) calls() []string {
+	ret := []string{}
+	for _, e := range g.edges {
+		ret = append(ret, g.nodes[e.from].label+" -> "+g.nodes[e.to].label)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func TestCallGraphOfImports(t *testing.T) {
+	dir := t.TempDir()
+	src := "module geo\nlet sq x = x * x\nlet area r = 3 * sq(r) + abs(r)\nexport area, sq\n"
+	if err := os.WriteFile(filepath.Join(dir, "geo.fn"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		imports []string
+		want    []string
+	}{
+		{
+			[]string{`from "geo" import area`},
+			[]string{"area -> (module of area).sq", "area -> abs", "g -> sq"},
+		},
+		{
+			[]string{`from "geo" import area, sq`},
+			[]string{"area -> abs", "area -> sq", "g -> sq"},
+		},
+		{
+			[]string{`import "geo" as geom`},
+			[]string{"g -> sq", "geom.area -> abs", "geom.area -> geom.sq"},
+		},
+	} {
+		r := NewRuntime()
+		if _, err := r.Define("let g x = sq(x)"); err != nil {
+			t.Fatal(err)
+		}
+		for _, imp := range tc.imports {
+			if _, err := r.Import(imp, dir); err != nil {
+				t.Fatal(err)
+			}
+		}
+		found := r.Snapshot().callGraph().calls()
+		if strings.Join(found, "\n") != strings.Join(tc.want, "\n") {
+			t.Errorf("%v: expected\n%s\nfound\n%s", tc.imports, strings.Join(tc.want, "\n"), strings.Join(found, "\n"))
+		}
+	}
+}
@@ -1,5 +1,11 @@
 package parser
 
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
 func isReserved(s string) bool {
 	for _, k := range Keywords {
 		if s == k {
@@ -25,3 +31,37 @@ func findParens(runes []rune) int {
 	}
 	return -1
 }
+
+// ValidateIdentifier returns an error if the name cannot be used for a function or input
+func ValidateIdentifier(name string) error {
+	if len(name) == 0 {
+		return fmt.Errorf("Invalid identifier. Name is empty")
+	}
+	for i, r := range name {
+		if !IsIdentifierRune(r) {
+			return invalidSymbolError(r, i)
+		}
+	}
+	if isReserved(name) {
+		return fmt.Errorf("Invalid identifier. `%s` is a reserved word", name)
+	}
+	return nil
+}
+
+// validateName returns an error if the name is not an identifier or a name qualified by the
+// module it is imported from, as in g.area
+func validateName(name string) error {
+	for _, part := range strings.Split(name, QualifierSeparator) {
+		if err := ValidateIdentifier(part); err != nil {
+			return fmt.Errorf("Invalid name `%s`. %v", name, err)
+		}
+	}
+	return nil
+}
+
+// IsIdentifierRune returns whether the rune can be part of an identifier. Names are letters and
+// underscores, so that `_` and names such as `sum_sq` can be used as they are in most languages.
+// Every place that reads a name uses this, so definitions, calls, symbols and keywords agree
+func IsIdentifierRune(r rune) bool {
+	return unicode.IsLetter(r) || r == '_'
+}
@@ -0,0 +1,71 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// EvalHook observes an evaluation as it runs. Depth is the number of nested function calls,
+// starting at 1 for a call made directly by the evaluated expression. The methods may be
+// called from several goroutines at once when the evaluation runs in parallel
+type EvalHook interface {
+	// Call is called when a function is called, before it is evaluated
+	Call(depth int, name string, args []Value)
+	// Return is called when a function call returns
+	Return(depth int, name string, args []Value, result Value, err error)
+	// Branch is called when a conditional takes a branch, with the value of its predicate
+	Branch(depth int, cond *Conditional, predicate Value)
+}
+
+// Tracer is an EvalHook that writes each function call, return and branch taken, indented by depth
+type Tracer struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewTracer creates a tracer writing to w
+func NewTracer(w io.Writer) *Tracer {
+	return &Tracer{w: w}
+}
+
+// Call writes the function call
+func (t *Tracer) Call(depth int, name string, args []Value) {
+	t.printf(depth-1, "%s", callString(name, args))
+}
+
+// Return writes the result of the function call
+func (t *Tracer) Return(depth int, name string, args []Value, result Value, err error) {
+	if err != nil {
+		t.printf(depth-1, "%s failed: %v", callString(name, args), err)
+		return
+	}
+	t.printf(depth-1, "%s = %d", callString(name, args), result)
+}
+
+// Branch writes the branch taken by the conditional
+func (t *Tracer) Branch(depth int, cond *Conditional, predicate Value) {
+	branch := KeywordThen
+	if predicate == 0 {
+		branch = KeywordElse
+	}
+	t.printf(depth, "%s %s is %d, taking %s", KeywordIf, cond.Predicate.String(), predicate, branch)
+}
+
+func (t *Tracer) printf(depth int, format string, args ...interface{}) {
+	if depth < 0 {
+		depth = 0
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	fmt.Fprintf(t.w, strings.Repeat("  ", depth)+format+"\n", args...)
+}
+
+func callString(name string, args []Value) string {
+	strs := make([]string, 0, len(args))
+	for _, arg := range args {
+		strs = append(strs, fmt.Sprintf("%d", arg))
+	}
+	return fmt.Sprintf("%s(%s)", name, strings.Join(strs, ","))
+}
@@ -0,0 +1,33 @@
+package parser
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestTracerOrder(t *testing.T) {
+	r := NewRuntime()
+	for _, src := range []string{"let g x = x + 1", "let f x = if x > 0 then g(x) * g(x + 1) else 0"} {
+		if _, err := r.Define(src); err != nil {
+			t.Fatal(err)
+		}
+	}
+	buf := &bytes.Buffer{}
+	r.Hook = NewTracer(buf)
+	if v, err := r.Eval("f(1) + g(5)"); err != nil || v != 12 {
+		t.Fatalf("Expected 12, found %d %v", v, err)
+	}
+	// each call is written when it is entered and again when it returns, within the calls it makes
+	want := "f(1)\n" +
+		"  if x>0 is 1, taking then\n" +
+		"  g(1)\n" +
+		"  g(1) = 2\n" +
+		"  g(2)\n" +
+		"  g(2) = 3\n" +
+		"f(1) = 6\n" +
+		"g(5)\n" +
+		"g(5) = 6\n"
+	if buf.String() != want {
+		t.Errorf("Expected the trace\n%s\nfound\n%s", want, buf.String())
+	}
+}
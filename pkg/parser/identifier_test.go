@@ -0,0 +1,32 @@
+package parser
+
+import "testing"
+
+func TestUnderscoreIdentifiers(t *testing.T) {
+	r := NewRuntime()
+	if _, err := r.Define("let sum_sq a_b _c = a_b * a_b + _c * _c"); err != nil {
+		t.Fatal(err)
+	}
+	zero := Value(0)
+	r.Environment.Set("_", FromValue(&zero))
+	for src, want := range map[string]Value{
+		"sum_sq(1, 2)":         5,
+		"sum_sq(_, _ + 3)":     9,
+		"if _ then 1 else 2":   2,
+		"sum_sq(1, 2) + _":     5,
+		"sum_sq(_ + 1, _) * 2": 2,
+	} {
+		val, err := r.Eval(src)
+		if err != nil || val != want {
+			t.Errorf("%s: expected %d, found %d %v", src, want, val, err)
+		}
+	}
+	for name, valid := range map[string]bool{"_": true, "a_b": true, "_if": true, "a1": false, "a-b": false, "if": false} {
+		if err := ValidateIdentifier(name); (err == nil) != valid {
+			t.Errorf("%s: expected valid %v, found %v", name, valid, err)
+		}
+	}
+	if Incomplete("x_if") || !Incomplete("if_x + if") {
+		t.Errorf("Expected keywords to be matched as whole names")
+	}
+}
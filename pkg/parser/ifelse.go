@@ -21,7 +21,7 @@ func parseConditional(runes []rune, startIdx int) (*Expression, int, error) {
 		return nil, -1, fmt.Errorf("Mismatched if-then statement")
 	}
 
-	pred, _, err := parse(runes[lenIf:close-1], startIdx, false)
+	pred, _, err := parse(runes[lenIf:close-1], startIdx+lenIf, false)
 	if err != nil {
 		return nil, -1, err
 	}
@@ -31,7 +31,7 @@ func parseConditional(runes []rune, startIdx int) (*Expression, int, error) {
 		return nil, -1, fmt.Errorf("Mismatched then-else statement")
 	}
 
-	then, _, err := parse(runes[close+lenThen:next-1], startIdx+close, false)
+	then, _, err := parse(runes[close+lenThen:next-1], startIdx+close+lenThen, false)
 	if err != nil {
 		return nil, -1, err
 	}
@@ -50,7 +50,7 @@ func parseConditional(runes []rune, startIdx int) (*Expression, int, error) {
 		True:      then,
 		False:     last,
 	}
-	return &Expression{Conditional: cond}, len(runes), nil
+	return &Expression{Conditional: cond, Index: startIdx}, len(runes), nil
 }
 
 func findIfThenClose(runes []rune) int {
@@ -0,0 +1,268 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// JSONVersion is the version of the JSON schema for trees, functions and contexts. It is
+// written with each AST, Function and Context, and unmarshaling fails for other versions
+const JSONVersion = 1
+
+// expressionJSON is an expression node. Exactly one of value, symbol, op, if or call is set.
+// Index is the position of the node in the source it was parsed from, which errors report
+type expressionJSON struct {
+	Value  *Value        `json:"value,omitempty"`
+	Symbol *Symbol       `json:"symbol,omitempty"`
+	Op     *Operator     `json:"op,omitempty"`
+	Left   *Expression   `json:"left,omitempty"`
+	Right  *Expression   `json:"right,omitempty"`
+	If     *Expression   `json:"if,omitempty"`
+	Then   *Expression   `json:"then,omitempty"`
+	Else   *Expression   `json:"else,omitempty"`
+	Call   *string       `json:"call,omitempty"`
+	Args   []*Expression `json:"args,omitempty"`
+	Negate bool          `json:"negate,omitempty"`
+	Index  int           `json:"index,omitempty"`
+}
+
+type astJSON struct {
+	Version int         `json:"version"`
+	Root    *Expression `json:"root"`
+}
+
+type functionJSON struct {
+	Version int         `json:"version,omitempty"`
+	Name    *string     `json:"name,omitempty"`
+	Inputs  []string    `json:"inputs"`
+	Body    *Expression `json:"body"`
+	Doc     string      `json:"doc,omitempty"`
+	Line    int         `json:"line,omitempty"`
+}
+
+type contextJSON struct {
+	Version int                `json:"version"`
+	Vars    map[string]varJSON `json:"vars"`
+}
+
+// varJSON is a variable of a context. Exactly one of value, symbol or function is set
+type varJSON struct {
+	Value    *Value        `json:"value,omitempty"`
+	Symbol   *Symbol       `json:"symbol,omitempty"`
+	Function *functionJSON `json:"function,omitempty"`
+}
+
+// MarshalJSON encodes the expression as a tree of nodes
+func (exp *Expression) MarshalJSON() ([]byte, error) {
+	node := expressionJSON{
+		Value:  exp.Val,
+		Symbol: exp.Symbol,
+		Negate: exp.Negate,
+		Index:  exp.Index,
+	}
+	switch {
+	case exp.Functional != nil:
+		node.Call = &exp.Functional.Name
+		node.Args = exp.Functional.Inputs
+	case exp.Conditional != nil:
+		node.If = exp.Conditional.Predicate
+		node.Then = exp.Conditional.True
+		node.Else = exp.Conditional.False
+	case exp.Val == nil && exp.Symbol == nil:
+		node.Op = exp.Op
+		node.Left = exp.Left
+		node.Right = exp.Right
+	}
+	return json.Marshal(node)
+}
+
+// UnmarshalJSON decodes an expression encoded by MarshalJSON
+func (exp *Expression) UnmarshalJSON(data []byte) error {
+	node := expressionJSON{}
+	if err := json.Unmarshal(data, &node); err != nil {
+		return err
+	}
+	kinds := 0
+	for _, set := range []bool{node.Value != nil, node.Symbol != nil, node.Op != nil, node.If != nil, node.Call != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return fmt.Errorf("Invalid expression. Exactly one of value, symbol, op, if or call must be set")
+	}
+	*exp = Expression{Val: node.Value, Symbol: node.Symbol, Negate: node.Negate, Index: node.Index}
+	switch {
+	case node.Symbol != nil:
+		if err := validateName(string(*node.Symbol)); err != nil {
+			return err
+		}
+	case node.Op != nil:
+		if !isOperator(*node.Op) {
+			return fmt.Errorf("Invalid expression. Unknown operator `%s`", *node.Op)
+		}
+		if node.Left == nil || node.Right == nil {
+			return fmt.Errorf("Invalid expression. Operator `%s` is missing a side", *node.Op)
+		}
+		exp.Op, exp.Left, exp.Right = node.Op, node.Left, node.Right
+	case node.If != nil:
+		if node.Then == nil || node.Else == nil {
+			return fmt.Errorf("Invalid expression. Conditional is missing then or else")
+		}
+		exp.Conditional = &Conditional{Predicate: node.If, True: node.Then, False: node.Else}
+	case node.Call != nil:
+		if err := validateName(*node.Call); err != nil {
+			return err
+		}
+		for _, arg := range node.Args {
+			if arg == nil {
+				return fmt.Errorf("Invalid expression. Call to `%s` has an empty argument", *node.Call)
+			}
+		}
+		exp.Functional = &Functional{Name: *node.Call, Inputs: append([]*Expression{}, node.Args...)}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the tree with the schema version
+func (a *AST) MarshalJSON() ([]byte, error) {
+	return json.Marshal(astJSON{Version: JSONVersion, Root: a.Root})
+}
+
+// UnmarshalJSON decodes a tree encoded by MarshalJSON, rebuilding its symbol table
+func (a *AST) UnmarshalJSON(data []byte) error {
+	v := astJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkJSONVersion(v.Version); err != nil {
+		return err
+	}
+	if v.Root == nil {
+		return fmt.Errorf("Invalid tree. Root is missing")
+	}
+	*a = *newAST(v.Root)
+	return nil
+}
+
+// MarshalJSON encodes the function with the schema version. The scope of an imported function is not encoded
+func (f *Function) MarshalJSON() ([]byte, error) {
+	v := f.toJSON()
+	v.Version = JSONVersion
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a function encoded by MarshalJSON, checking that its body only uses its inputs
+func (f *Function) UnmarshalJSON(data []byte) error {
+	v := functionJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkJSONVersion(v.Version); err != nil {
+		return err
+	}
+	fn, err := v.function()
+	if err != nil {
+		return err
+	}
+	*f = *fn
+	return nil
+}
+
+// MarshalJSON encodes the values, symbols and functions of the context with the schema version.
+// Go functions and functions imported from modules are left out, as they cannot be encoded
+func (c Context) MarshalJSON() ([]byte, error) {
+	v := contextJSON{Version: JSONVersion, Vars: make(map[string]varJSON)}
+	for name, cv := range c {
+		switch {
+		case cv.Value != nil:
+			v.Vars[name] = varJSON{Value: cv.Value}
+		case cv.Symbol != nil:
+			v.Vars[name] = varJSON{Symbol: cv.Symbol}
+		case cv.Function != nil && cv.Function.Scope == nil:
+			fn := cv.Function.toJSON()
+			v.Vars[name] = varJSON{Function: &fn}
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalJSON decodes a context encoded by MarshalJSON, replacing the variables of the context
+func (c *Context) UnmarshalJSON(data []byte) error {
+	v := contextJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if err := checkJSONVersion(v.Version); err != nil {
+		return err
+	}
+	ctx := NewContext()
+	for name, cv := range v.Vars {
+		if err := validateName(name); err != nil {
+			return fmt.Errorf("Variable `%s`: %v", name, err)
+		}
+		switch {
+		case cv.Value != nil && cv.Symbol == nil && cv.Function == nil:
+			ctx[name] = FromValue(cv.Value)
+		case cv.Symbol != nil && cv.Value == nil && cv.Function == nil:
+			ctx[name] = FromSymbol(cv.Symbol)
+		case cv.Function != nil && cv.Value == nil && cv.Symbol == nil:
+			fn, err := cv.Function.function()
+			if err != nil {
+				return fmt.Errorf("Variable `%s`: %v", name, err)
+			}
+			ctx[name] = FromFunc(fn)
+		default:
+			return fmt.Errorf("Invalid variable `%s`. Exactly one of value, symbol or function must be set", name)
+		}
+	}
+	*c = ctx
+	return nil
+}
+
+func (f *Function) toJSON() functionJSON {
+	v := functionJSON{Name: f.Name, Inputs: f.Inputs, Doc: f.Doc, Line: f.Line}
+	if f.Body != nil {
+		v.Body = f.Body.Root
+	}
+	if v.Inputs == nil {
+		v.Inputs = []string{}
+	}
+	return v
+}
+
+func (v functionJSON) function() (*Function, error) {
+	if v.Body == nil {
+		return nil, fmt.Errorf("Invalid function. Body is missing")
+	}
+	for _, input := range v.Inputs {
+		if err := ValidateIdentifier(input); err != nil {
+			return nil, err
+		}
+	}
+	if v.Name != nil {
+		if err := ValidateIdentifier(*v.Name); err != nil {
+			return nil, err
+		}
+	}
+	f := &Function{Name: v.Name, Inputs: v.Inputs, Body: newAST(v.Body), Doc: v.Doc, Line: v.Line}
+	if f.Inputs == nil {
+		f.Inputs = []string{}
+	}
+	return f, f.validate()
+}
+
+func checkJSONVersion(version int) error {
+	if version != JSONVersion {
+		return fmt.Errorf("Unsupported schema version %d. Expected version %d", version, JSONVersion)
+	}
+	return nil
+}
+
+func isOperator(o Operator) bool {
+	switch o {
+	case Plus, Times, Divided, Power, GreaterThan, LessThan, Or, And, Equal:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package parser
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONKeepsPositions(t *testing.T) {
+	f, err := ParseFunction("let f x = x + g(x, 1)", NewContext())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Function{}
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.String() != f.String() {
+		t.Fatalf("Expected %s, found %s", f.String(), decoded.String())
+	}
+	if want, found := f.Body.Root.Right.Index, decoded.Body.Root.Right.Index; want == 0 || want != found {
+		t.Fatalf("Expected the call at index %d, found %d", want, found)
+	}
+}
+
+func TestJSONRejectsInvalidNames(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		into interface{}
+	}{
+		{`{"symbol":"a b c"}`, &Expression{}},
+		{`{"symbol":"if"}`, &Expression{}},
+		{`{"call":"1 2"}`, &Expression{}},
+		{`{"call":"f(x)","args":[{"value":1}]}`, &Expression{}},
+		{`{"call":"g.","args":[{"value":1}]}`, &Expression{}},
+		{`{"op":"+","right":{"value":1}}`, &Expression{}},
+		{`{"op":"+","left":{"value":1}}`, &Expression{}},
+		{`{"version":1,"vars":{"if":{"value":1}}}`, &Context{}},
+		{`{"version":1,"vars":{"x y":{"value":1}}}`, &Context{}},
+		{`{"version":1,"vars":{"":{"value":1}}}`, &Context{}},
+	} {
+		if err := json.Unmarshal([]byte(tc.data), tc.into); err == nil {
+			t.Errorf("%s: expected an error", tc.data)
+		}
+	}
+	exp := &Expression{}
+	if err := json.Unmarshal([]byte(`{"call":"g.area","args":[{"symbol":"x"}]}`), exp); err != nil || exp.Functional.Name != "g.area" {
+		t.Fatalf("Expected a call to g.area, found %v %v", exp, err)
+	}
+	ctx := Context{}
+	if err := json.Unmarshal([]byte(`{"version":1,"vars":{"sum_sq":{"value":1}}}`), &ctx); err != nil || !strings.Contains(ctx["sum_sq"].String(), "1") {
+		t.Fatalf("Expected sum_sq = 1, found %v %v", ctx, err)
+	}
+}
@@ -0,0 +1,287 @@
+package parser
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// Precedences of rendered formulas, following the usual reading of mathematical notation
+// rather than how expressions are parsed, so that a formula reads as its tree evaluates
+const (
+	precCases = iota
+	precOr
+	precAnd
+	precCompare
+	precSum
+	precProduct
+	precNegate
+	precFraction
+	precPower
+	precAtom
+)
+
+// mathMLNamespace is the namespace of the math element
+const mathMLNamespace = "http://www.w3.org/1998/Math/MathML"
+
+// LaTeX returns the expression as a LaTeX formula. Division is a fraction, powers are
+// superscripts and conditionals are cases
+func (exp *Expression) LaTeX() string {
+	s, _ := renderMath(exp, latex{})
+	return s
+}
+
+// MathML returns the expression as a presentation MathML math element
+func (exp *Expression) MathML() string {
+	s, _ := renderMath(exp, mathML{})
+	return mathML{}.math(s)
+}
+
+// LaTeX returns the function as a LaTeX equation of its call and its body
+func (f *Function) LaTeX() string {
+	return renderFunction(f, latex{})
+}
+
+// MathML returns the function as a presentation MathML math element equating its call and its body
+func (f *Function) MathML() string {
+	return mathML{}.math(renderFunction(f, mathML{}))
+}
+
+// mathRenderer writes the parts of a formula in a markup language
+type mathRenderer interface {
+	value(v Value) string
+	symbol(name string) string
+	call(name string, args []string) string
+	operator(op Operator, l, r string) string
+	minus(l, r string) string
+	fraction(n, d string) string
+	power(base, exp string) string
+	negate(s string) string
+	parens(s string) string
+	// cases writes the rows of values and conditions, with the last value taken otherwise
+	cases(values, conditions []string) string
+	maps(inputs []string, body string) string
+}
+
+func renderFunction(f *Function, r mathRenderer) string {
+	body, _ := renderMath(f.Body.Root, r)
+	args := make([]string, 0, len(f.Inputs))
+	for _, input := range f.Inputs {
+		args = append(args, r.symbol(input))
+	}
+	if f.Name == nil {
+		return r.maps(args, body)
+	}
+	return r.operator(Equal, r.call(*f.Name, args), body)
+}
+
+// renderMath renders the expression, returning the precedence of the result
+func renderMath(exp *Expression, r mathRenderer) (string, int) {
+	if exp == nil {
+		return "", precAtom
+	}
+	if exp.Negate {
+		inner := *exp
+		inner.Negate = false
+		return r.negate(operand(&inner, r, precNegate)), precNegate
+	}
+	switch {
+	case exp.Val != nil:
+		return r.value(*exp.Val), precAtom
+	case exp.Symbol != nil:
+		return r.symbol(string(*exp.Symbol)), precAtom
+	case exp.Functional != nil:
+		args := make([]string, 0, len(exp.Functional.Inputs))
+		for _, input := range exp.Functional.Inputs {
+			s, _ := renderMath(input, r)
+			args = append(args, s)
+		}
+		return r.call(exp.Functional.Name, args), precAtom
+	case exp.Conditional != nil:
+		values, conditions := []string{}, []string{}
+		for exp.Conditional != nil && !exp.Negate {
+			v, _ := renderMath(exp.Conditional.True, r)
+			c, _ := renderMath(exp.Conditional.Predicate, r)
+			values, conditions = append(values, v), append(conditions, c)
+			exp = exp.Conditional.False
+		}
+		v, _ := renderMath(exp, r)
+		return r.cases(append(values, v), conditions), precCases
+	}
+	if exp.Left == nil {
+		return renderMath(exp.Right, r)
+	}
+	switch *exp.Op {
+	case Plus:
+		if exp.Right != nil && exp.Right.Negate {
+			right := *exp.Right
+			right.Negate = false
+			return r.minus(operand(exp.Left, r, precSum), operand(&right, r, precSum+1)), precSum
+		}
+		return r.operator(Plus, operand(exp.Left, r, precSum), operand(exp.Right, r, precSum)), precSum
+	case Times:
+		return r.operator(Times, operand(exp.Left, r, precProduct), operand(exp.Right, r, precProduct)), precProduct
+	case Divided:
+		n, _ := renderMath(exp.Left, r)
+		d, _ := renderMath(exp.Right, r)
+		return r.fraction(n, d), precFraction
+	case Power:
+		e, _ := renderMath(exp.Right, r)
+		return r.power(operand(exp.Left, r, precAtom), e), precPower
+	case Or:
+		return r.operator(Or, operand(exp.Left, r, precOr), operand(exp.Right, r, precOr)), precOr
+	case And:
+		return r.operator(And, operand(exp.Left, r, precAnd), operand(exp.Right, r, precAnd)), precAnd
+	}
+	return r.operator(*exp.Op, operand(exp.Left, r, precCompare+1), operand(exp.Right, r, precCompare+1)), precCompare
+}
+
+// operand renders the expression, in parentheses if its precedence is below min
+func operand(exp *Expression, r mathRenderer, min int) string {
+	s, prec := renderMath(exp, r)
+	if prec < min {
+		return r.parens(s)
+	}
+	return s
+}
+
+// latex renders LaTeX
+type latex struct{}
+
+var latexOperators = map[Operator]string{
+	Plus:        "+",
+	Times:       "\\cdot",
+	GreaterThan: ">",
+	LessThan:    "<",
+	Equal:       "=",
+	Or:          "\\lor",
+	And:         "\\land",
+}
+
+func (latex) value(v Value) string {
+	return fmt.Sprintf("%d", v)
+}
+
+// symbol writes names longer than one letter upright, so they do not read as products
+func (latex) symbol(name string) string {
+	name = strings.Replace(name, "_", "\\_", -1)
+	if utf8.RuneCountInString(name) > 1 {
+		return "\\mathit{" + name + "}"
+	}
+	return name
+}
+
+func (latex) call(name string, args []string) string {
+	escaped := strings.Replace(name, "_", "\\_", -1)
+	if utf8.RuneCountInString(name) > 1 {
+		escaped = "\\operatorname{" + escaped + "}"
+	}
+	return escaped + "\\left(" + strings.Join(args, ", ") + "\\right)"
+}
+
+func (latex) operator(op Operator, l, r string) string {
+	return l + " " + latexOperators[op] + " " + r
+}
+
+func (latex) minus(l, r string) string {
+	return l + " - " + r
+}
+
+func (latex) fraction(n, d string) string {
+	return "\\frac{" + n + "}{" + d + "}"
+}
+
+func (latex) power(base, exp string) string {
+	return base + "^{" + exp + "}"
+}
+
+func (latex) negate(s string) string {
+	return "-" + s
+}
+
+func (latex) parens(s string) string {
+	return "\\left(" + s + "\\right)"
+}
+
+func (latex) cases(values, conditions []string) string {
+	rows := []string{}
+	for i, c := range conditions {
+		rows = append(rows, values[i]+" & \\text{if } "+c)
+	}
+	rows = append(rows, values[len(values)-1]+" & \\text{otherwise}")
+	return "\\begin{cases} " + strings.Join(rows, " \\\\ ") + " \\end{cases}"
+}
+
+func (latex) maps(inputs []string, body string) string {
+	return "\\left(" + strings.Join(inputs, ", ") + "\\right) \\mapsto " + body
+}
+
+// mathML renders presentation MathML
+type mathML struct{}
+
+var mathMLOperators = map[Operator]string{
+	Plus:        "+",
+	Times:       "&#x22C5;",
+	GreaterThan: "&gt;",
+	LessThan:    "&lt;",
+	Equal:       "=",
+	Or:          "&#x2228;",
+	And:         "&#x2227;",
+}
+
+func (mathML) math(s string) string {
+	return fmt.Sprintf("<math xmlns=%q>%s</math>", mathMLNamespace, s)
+}
+
+func (mathML) value(v Value) string {
+	if v < 0 {
+		return fmt.Sprintf("<mrow><mo>-</mo><mn>%d</mn></mrow>", -v)
+	}
+	return fmt.Sprintf("<mn>%d</mn>", v)
+}
+
+func (mathML) symbol(name string) string {
+	return "<mi>" + html.EscapeString(name) + "</mi>"
+}
+
+func (m mathML) call(name string, args []string) string {
+	return "<mrow><mi>" + html.EscapeString(name) + "</mi><mo>&#x2061;</mo>" + m.parens(strings.Join(args, "<mo>,</mo>")) + "</mrow>"
+}
+
+func (mathML) operator(op Operator, l, r string) string {
+	return "<mrow>" + l + "<mo>" + mathMLOperators[op] + "</mo>" + r + "</mrow>"
+}
+
+func (mathML) minus(l, r string) string {
+	return "<mrow>" + l + "<mo>-</mo>" + r + "</mrow>"
+}
+
+func (mathML) fraction(n, d string) string {
+	return "<mfrac>" + n + d + "</mfrac>"
+}
+
+func (mathML) power(base, exp string) string {
+	return "<msup>" + base + exp + "</msup>"
+}
+
+func (mathML) negate(s string) string {
+	return "<mrow><mo>-</mo>" + s + "</mrow>"
+}
+
+func (mathML) parens(s string) string {
+	return "<mrow><mo>(</mo>" + s + "<mo>)</mo></mrow>"
+}
+
+func (mathML) cases(values, conditions []string) string {
+	rows := []string{}
+	for i, c := range conditions {
+		rows = append(rows, "<mtr><mtd>"+values[i]+"</mtd><mtd><mtext>if&#xA0;</mtext>"+c+"</mtd></mtr>")
+	}
+	rows = append(rows, "<mtr><mtd>"+values[len(values)-1]+"</mtd><mtd><mtext>otherwise</mtext></mtd></mtr>")
+	return "<mrow><mo>{</mo><mtable columnalign=\"left\">" + strings.Join(rows, "") + "</mtable></mrow>"
+}
+
+func (m mathML) maps(inputs []string, body string) string {
+	return "<mrow>" + m.parens(strings.Join(inputs, "<mo>,</mo>")) + "<mo>&#x21A6;</mo>" + body + "</mrow>"
+}
@@ -0,0 +1,76 @@
+package parser
+
+import "testing"
+
+func TestMath(t *testing.T) {
+	cases := []struct {
+		src, latex, mathML string
+	}{
+		{
+			src:    "(a+b)^2",
+			latex:  `\left(a + b\right)^{2}`,
+			mathML: `<msup><mrow><mo>(</mo><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow><mo>)</mo></mrow><mn>2</mn></msup>`,
+		},
+		{
+			src:    "a-(b-c)",
+			latex:  `a - \left(b - c\right)`,
+			mathML: `<mrow><mi>a</mi><mo>-</mo><mrow><mo>(</mo><mrow><mi>b</mi><mo>-</mo><mi>c</mi></mrow><mo>)</mo></mrow></mrow>`,
+		},
+		{
+			src:    "a-b-c",
+			latex:  `a - b - c`,
+			mathML: `<mrow><mrow><mi>a</mi><mo>-</mo><mi>b</mi></mrow><mo>-</mo><mi>c</mi></mrow>`,
+		},
+		{
+			src:    "(a+b)/(c*2)",
+			latex:  `\frac{a + b}{c \cdot 2}`,
+			mathML: `<mfrac><mrow><mi>a</mi><mo>+</mo><mi>b</mi></mrow><mrow><mi>c</mi><mo>&#x22C5;</mo><mn>2</mn></mrow></mfrac>`,
+		},
+		{
+			src:   "if x > 1 then x else if x < 0 then -x else 0",
+			latex: `\begin{cases} x & \text{if } x > 1 \\ -x & \text{if } x < 0 \\ 0 & \text{otherwise} \end{cases}`,
+			mathML: `<mrow><mo>{</mo><mtable columnalign="left">` +
+				`<mtr><mtd><mi>x</mi></mtd><mtd><mtext>if&#xA0;</mtext><mrow><mi>x</mi><mo>&gt;</mo><mn>1</mn></mrow></mtd></mtr>` +
+				`<mtr><mtd><mrow><mo>-</mo><mi>x</mi></mrow></mtd><mtd><mtext>if&#xA0;</mtext><mrow><mi>x</mi><mo>&lt;</mo><mn>0</mn></mrow></mtd></mtr>` +
+				`<mtr><mtd><mn>0</mn></mtd><mtd><mtext>otherwise</mtext></mtd></mtr></mtable></mrow>`,
+		},
+		{
+			src:    "sum_sq + f_g(a_b, 1)",
+			latex:  `\mathit{sum\_sq} + \operatorname{f\_g}\left(\mathit{a\_b}, 1\right)`,
+			mathML: `<mrow><mi>sum_sq</mi><mo>+</mo><mrow><mi>f_g</mi><mo>&#x2061;</mo><mrow><mo>(</mo><mi>a_b</mi><mo>,</mo><mn>1</mn><mo>)</mo></mrow></mrow></mrow>`,
+		},
+		{
+			src:    "(a < b) & (c > 1)",
+			latex:  `a < b \land c > 1`,
+			mathML: `<mrow><mrow><mi>a</mi><mo>&lt;</mo><mi>b</mi></mrow><mo>&#x2227;</mo><mrow><mi>c</mi><mo>&gt;</mo><mn>1</mn></mrow></mrow>`,
+		},
+	}
+	for _, c := range cases {
+		a, err := Parse(c.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if latex := a.Root.LaTeX(); latex != c.latex {
+			t.Errorf("%s: expected the LaTeX\n%s\nfound\n%s", c.src, c.latex, latex)
+		}
+		want := `<math xmlns="http://www.w3.org/1998/Math/MathML">` + c.mathML + `</math>`
+		if mathML := a.Root.MathML(); mathML != want {
+			t.Errorf("%s: expected the MathML\n%s\nfound\n%s", c.src, want, mathML)
+		}
+	}
+}
+
+func TestFunctionMath(t *testing.T) {
+	f, err := NewRuntime().Define("let sum_sq x y = x*x + y*y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `\operatorname{sum\_sq}\left(x, y\right) = x \cdot x + y \cdot y`; f.LaTeX() != want {
+		t.Errorf("Expected the LaTeX\n%s\nfound\n%s", want, f.LaTeX())
+	}
+	want := `<math xmlns="http://www.w3.org/1998/Math/MathML"><mrow><mrow><mi>sum_sq</mi><mo>&#x2061;</mo><mrow><mo>(</mo><mi>x</mi><mo>,</mo><mi>y</mi><mo>)</mo></mrow></mrow>` +
+		`<mo>=</mo><mrow><mrow><mi>x</mi><mo>&#x22C5;</mo><mi>x</mi></mrow><mo>+</mo><mrow><mi>y</mi><mo>&#x22C5;</mo><mi>y</mi></mrow></mrow></mrow></math>`
+	if f.MathML() != want {
+		t.Errorf("Expected the MathML\n%s\nfound\n%s", want, f.MathML())
+	}
+}
@@ -0,0 +1,291 @@
+package parser
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Module is a file of definitions loaded by an import. A module may declare its name with
+// `module name`, and the functions it exports with `export f, g`. Without an export
+// declaration every function defined in the module is exported
+type Module struct {
+	Name string
+	Path string
+	// Scope is the context the functions of the module are evaluated in
+	Scope Context
+	// Exports are the names of the exported functions, sorted
+	Exports []string
+}
+
+// Import is an import statement, either `import "path" [as alias]` to import the exports of
+// the module qualified by the alias or module name, as in `g.area(3)`, or
+// `from "path" import f, g` to import only the named exports without a qualifier
+type Import struct {
+	Path  string
+	Alias string
+	Names []string
+}
+
+// IsImport returns whether the source is an import statement
+func IsImport(src string) bool {
+	return startsWithKeyword(src, KeywordImport) || startsWithKeyword(src, KeywordFrom)
+}
+
+// IsModuleDeclaration returns whether the source is a module or export declaration
+func IsModuleDeclaration(src string) bool {
+	return startsWithKeyword(src, KeywordModule) || startsWithKeyword(src, KeywordExport)
+}
+
+// startsWithKeyword returns whether the first word of the source is the keyword followed by a space
+func startsWithKeyword(src, keyword string) bool {
+	runes := []rune(strings.TrimLeftFunc(StripComments(src), unicode.IsSpace))
+	n := len([]rune(keyword))
+	return len(runes) > n && strings.EqualFold(string(runes[:n]), keyword) && unicode.IsSpace(runes[n])
+}
+
+// ParseImport parses the import statement
+func ParseImport(src string) (*Import, error) {
+	syntax := fmt.Errorf("Invalid import. Syntax: %s \"module\" [%s name] or %s \"module\" %s name, ...", KeywordImport, KeywordAs, KeywordFrom, KeywordImport)
+	src = strings.TrimSpace(StripComments(src))
+	from := startsWithKeyword(src, KeywordFrom)
+	if from {
+		src = strings.TrimSpace(src[len(KeywordFrom):])
+	} else if startsWithKeyword(src, KeywordImport) {
+		src = strings.TrimSpace(src[len(KeywordImport):])
+	} else {
+		return nil, syntax
+	}
+	if !strings.HasPrefix(src, "\"") {
+		return nil, syntax
+	}
+	end := strings.Index(src[1:], "\"")
+	if end < 1 {
+		return nil, syntax
+	}
+	imp := &Import{Path: src[1 : end+1]}
+	rest := strings.Fields(src[end+2:])
+	switch {
+	case from && len(rest) > 1 && strings.EqualFold(rest[0], KeywordImport):
+		names, err := parseNames(strings.Join(rest[1:], " "))
+		if err != nil {
+			return nil, err
+		}
+		imp.Names = names
+	case !from && len(rest) == 2 && strings.EqualFold(rest[0], KeywordAs):
+		if err := ValidateIdentifier(rest[1]); err != nil {
+			return nil, err
+		}
+		imp.Alias = rest[1]
+	case !from && len(rest) == 0:
+	default:
+		return nil, syntax
+	}
+	return imp, nil
+}
+
+// ParseModuleDeclaration parses a `module name` declaration, returning the name
+func ParseModuleDeclaration(src string) (string, error) {
+	src = strings.TrimSpace(StripComments(src))
+	if !startsWithKeyword(src, KeywordModule) {
+		return "", fmt.Errorf("Invalid module declaration. Syntax: %s name", KeywordModule)
+	}
+	name := strings.TrimSpace(src[len(KeywordModule):])
+	return name, ValidateIdentifier(name)
+}
+
+// ParseExport parses an `export f, g` declaration, returning the names
+func ParseExport(src string) ([]string, error) {
+	src = strings.TrimSpace(StripComments(src))
+	if !startsWithKeyword(src, KeywordExport) {
+		return nil, fmt.Errorf("Invalid export. Syntax: %s name, ...", KeywordExport)
+	}
+	return parseNames(src[len(KeywordExport):])
+}
+
+// parseNames parses a list of identifiers separated by commas
+func parseNames(src string) ([]string, error) {
+	ret := []string{}
+	for _, name := range strings.Split(src, ",") {
+		name = strings.TrimSpace(name)
+		if err := ValidateIdentifier(name); err != nil {
+			return nil, err
+		}
+		ret = append(ret, name)
+	}
+	return ret, nil
+}
+
+// Import runs the import statement, adding the exports of the module to the environment.
+// The module is found relative to dir, then in each directory of the search path, then in
+// the working directory
+func (r *Runtime) Import(src, dir string) (*Module, error) {
+	return r.importModule(src, dir, nil)
+}
+
+// Imports returns the import statements run by the runtime, in order
+func (r *Runtime) Imports() []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]string{}, r.imports...)
+}
+
+// importModule runs the import statement. Loading are the paths of the modules being loaded,
+// to find cycles
+func (r *Runtime) importModule(src, dir string, loading []string) (*Module, error) {
+	imp, err := ParseImport(src)
+	if err != nil {
+		return nil, err
+	}
+	path, err := r.findModule(imp.Path, dir)
+	if err != nil {
+		return nil, err
+	}
+	m, err := r.loadModule(path, loading)
+	if err != nil {
+		return nil, err
+	}
+	err = r.Environment.Update(func(ctx Context) error {
+		for _, name := range imp.Names {
+			if !m.exports(name) {
+				return fmt.Errorf("Module `%s` does not export `%s`", m.Name, name)
+			}
+			if ctx.IsBuiltin(name) {
+				return fmt.Errorf("Cannot redefine builtin function `%s`", name)
+			}
+			ctx[name] = m.Scope[name]
+		}
+		if len(imp.Names) > 0 {
+			return nil
+		}
+		qualifier := imp.Alias
+		if len(qualifier) == 0 {
+			qualifier = m.Name
+		}
+		for _, name := range m.Exports {
+			fn := *m.Scope[name].Function
+			qualified := qualifier + QualifierSeparator + name
+			fn.Name = &qualified
+			ctx[qualified] = FromFunc(&fn)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	r.imports = append(r.imports, strings.TrimSpace(StripComments(src)))
+	r.lock.Unlock()
+	return m, nil
+}
+
+// findModule returns the path of the module file, trying the path as given and with the module extension
+func (r *Runtime) findModule(path, dir string) (string, error) {
+	dirs := []string{""}
+	if !filepath.IsAbs(path) {
+		dirs = []string{}
+		if len(dir) > 0 {
+			dirs = append(dirs, dir)
+		}
+		dirs = append(append(dirs, r.SearchPath...), ".")
+	}
+	for _, d := range dirs {
+		for _, candidate := range []string{path, path + ModuleExtension} {
+			candidate = filepath.Join(d, candidate)
+			if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+				return filepath.Abs(candidate)
+			}
+		}
+	}
+	return "", fmt.Errorf("Cannot find module `%s`", path)
+}
+
+// loadModule loads the module file into a new runtime, and makes the functions it defines
+// evaluate in its context
+func (r *Runtime) loadModule(path string, loading []string) (*Module, error) {
+	for i, p := range loading {
+		if p == path {
+			cycle := []string{}
+			for _, l := range append(loading[i:], path) {
+				cycle = append(cycle, filepath.Base(l))
+			}
+			return nil, fmt.Errorf("Import cycle: %s", strings.Join(cycle, " -> "))
+		}
+	}
+	loading = append(loading[:len(loading):len(loading)], path)
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	stmts, err := ReadStatements(f)
+	if err != nil {
+		return nil, err
+	}
+	m := &Module{Name: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), Path: path}
+	child := &Runtime{Environment: NewEnvironment(nil), Limits: r.Limits, Workers: r.Workers, Hook: r.Hook, SearchPath: r.SearchPath}
+	defined := []string{}
+	var exports []string
+	for n := 0; n < len(stmts); n++ {
+		stmt := stmts[n]
+		switch defs := LeadingDefinitions(stmts[n:]); {
+		case len(defs) > 0:
+			var fns []*Function
+			fns, err = child.DefineStatements(defs)
+			for _, fn := range fns {
+				defined = append(defined, *fn.Name)
+			}
+			if err != nil {
+				stmt = stmts[n+len(fns)]
+			}
+			n += len(defs) - 1
+		case startsWithKeyword(stmt.Source, KeywordModule):
+			m.Name, err = ParseModuleDeclaration(stmt.Source)
+		case startsWithKeyword(stmt.Source, KeywordExport):
+			var names []string
+			names, err = ParseExport(stmt.Source)
+			exports = append(exports, names...)
+		case IsImport(stmt.Source):
+			_, err = child.importModule(stmt.Source, filepath.Dir(path), loading)
+		default:
+			err = fmt.Errorf("Modules can only contain definitions, imports and exports")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %v", filepath.Base(path), stmt.Line, err)
+		}
+	}
+
+	m.Scope = child.Snapshot()
+	for name, v := range m.Scope {
+		if v.Function != nil && v.Function.Scope == nil {
+			fn := *v.Function
+			fn.Scope = m.Scope
+			m.Scope[name] = FromFunc(&fn)
+		}
+	}
+	if exports == nil {
+		exports = defined
+	}
+	for _, name := range exports {
+		if v, ok := m.Scope[name]; !ok || v.Function == nil {
+			return nil, fmt.Errorf("Module `%s` exports undefined function `%s`", m.Name, name)
+		}
+		if !m.exports(name) {
+			m.Exports = append(m.Exports, name)
+		}
+	}
+	sort.Strings(m.Exports)
+	return m, nil
+}
+
+func (m *Module) exports(name string) bool {
+	for _, e := range m.Exports {
+		if e == name {
+			return true
+		}
+	}
+	return false
+}
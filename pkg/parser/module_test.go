@@ -0,0 +1,132 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeModule(t *testing.T, dir, name, src string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportQualifiers(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "geo.fn", "module geometry\nexport area\nlet sq x = x * x\nlet area w = sq(w) + 1\n")
+	r := NewRuntime()
+	// a global sq does not change the sq the module calls
+	if _, err := r.Define("let sq a b = a + b"); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{`import "geo"`, `import "geo" as g`} {
+		if _, err := r.Import(src, dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v, err := r.Eval("geometry.area(3) + g.area(2)"); err != nil || v != 15 {
+		t.Fatalf("Expected 15, found %d %v", v, err)
+	}
+	for _, name := range []string{"area", "g.sq", "geo.area"} {
+		if _, ok := r.Snapshot()[name]; ok {
+			t.Errorf("Expected %s not to be imported", name)
+		}
+	}
+	if imports := r.Imports(); len(imports) != 2 || imports[1] != `import "geo" as g` {
+		t.Errorf("Expected the imports to be recorded, found %v", imports)
+	}
+}
+
+func TestFromImport(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "geo.fn", "export area\nlet sq x = x * x\nlet area w = sq(w)\n")
+	writeModule(t, dir, "all.fn", "let one x = 1\nlet two x = one(x) + 1\n")
+	writeModule(t, dir, "abs.fn", "let abs x = x\n")
+	r := NewRuntime()
+	if _, err := r.Import(`from "geo" import area`, dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Import(`from "all.fn" import two`, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.Eval("area(3) + two(0)"); err != nil || v != 11 {
+		t.Fatalf("Expected 11, found %d %v", v, err)
+	}
+	for src, want := range map[string]string{
+		`from "geo" import sq`:    "does not export `sq`",
+		`from "geo" import nope`:  "does not export `nope`",
+		`from "abs" import abs`:   "Cannot redefine builtin function `abs`",
+		`import "missing"`:        "Cannot find module `missing`",
+		`import "geo" as if`:      "reserved word",
+		`from "geo" import area,`: "Invalid",
+	} {
+		if _, err := r.Import(src, dir); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected an error containing %q, found %v", src, want, err)
+		}
+	}
+}
+
+func TestImportCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeModule(t, dir, "a.fn", "import \"b\"\nlet fa x = x\n")
+	writeModule(t, dir, "b.fn", "import \"c\"\nlet fb x = x\n")
+	writeModule(t, dir, "c.fn", "import \"a\"\nlet fc x = x\n")
+	_, err := NewRuntime().Import(`import "a"`, dir)
+	if err == nil || !strings.Contains(err.Error(), "Import cycle: a.fn -> b.fn -> c.fn -> a.fn") {
+		t.Fatalf("Expected an import cycle, found %v", err)
+	}
+
+	// importing the same module twice without a cycle is allowed
+	writeModule(t, dir, "base.fn", "let one x = 1\n")
+	writeModule(t, dir, "left.fn", "import \"base\"\nlet l x = base.one(x)\n")
+	writeModule(t, dir, "top.fn", "import \"base\"\nimport \"left\"\nlet t x = base.one(x) + left.l(x)\n")
+	r := NewRuntime()
+	if _, err := r.Import(`import "top"`, dir); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.Eval("top.t(0)"); err != nil || v != 2 {
+		t.Fatalf("Expected 2, found %d %v", v, err)
+	}
+}
+
+func TestSearchPath(t *testing.T) {
+	root := t.TempDir()
+	first, second, local := filepath.Join(root, "first"), filepath.Join(root, "second"), filepath.Join(root, "local")
+	writeModule(t, first, "m.fn", "let v x = 1\n")
+	writeModule(t, second, "m.fn", "let v x = 2\n")
+	writeModule(t, second, "only.fn", "import \"inner\"\nlet w x = inner.i(x)\n")
+	writeModule(t, second, "inner.fn", "let i x = 20\n")
+	writeModule(t, local, "m.fn", "let v x = 3\n")
+
+	r := NewRuntime()
+	r.SearchPath = []string{first, second}
+	for _, c := range []struct {
+		dir  string
+		want Value
+	}{
+		{dir: local, want: 3},
+		{dir: "", want: 1},
+		{dir: filepath.Join(root, "missing"), want: 1},
+	} {
+		if _, err := r.Import(`import "m" as mod`, c.dir); err != nil {
+			t.Fatal(err)
+		}
+		if v, err := r.Eval("mod.v(0)"); err != nil || v != c.want {
+			t.Errorf("From %s: expected %d, found %d %v", c.dir, c.want, v, err)
+		}
+	}
+
+	// modules import relative to their own file before the search path
+	if _, err := r.Import(`import "only"`, ""); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := r.Eval("only.w(0)"); err != nil || v != 20 {
+		t.Fatalf("Expected 20, found %d %v", v, err)
+	}
+}
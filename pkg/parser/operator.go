@@ -1,9 +1,13 @@
 package parser
 
 import (
+	"errors"
 	"math"
 )
 
+// ErrDivisionByZero is returned when an expression divides by zero. It ends the evaluation
+var ErrDivisionByZero = errors.New("Division by zero")
+
 // Operator is an operator
 type Operator string
 
@@ -38,44 +42,47 @@ func (o *Operator) Distributive() bool {
 	return o.Equal(times()) || o.Equal(divide()) || o.Equal(power()) || o.Equal(and())
 }
 
-// Evaluate evaluates this operator
-func (o Operator) Evaluate(v1, v2 Value) Value {
+// Evaluate evaluates this operator, failing with ErrDivisionByZero for a zero divisor
+func (o Operator) Evaluate(v1, v2 Value) (Value, error) {
 	i1 := int(v1)
 	i2 := int(v2)
 	switch o {
 	case Plus:
-		return Value(i1 + i2)
+		return Value(i1 + i2), nil
 	case Times:
-		return Value(i1 * i2)
+		return Value(i1 * i2), nil
 	case Divided:
-		return Value(i1 / i2)
+		if i2 == 0 {
+			return -1, ErrDivisionByZero
+		}
+		return Value(i1 / i2), nil
 	case Power:
-		return Value(int(math.Pow(float64(i1), float64(i2))))
+		return Value(int(math.Pow(float64(i1), float64(i2)))), nil
 	case GreaterThan:
 		if v1 > v2 {
-			return Value(1)
+			return Value(1), nil
 		}
-		return Value(0)
+		return Value(0), nil
 	case LessThan:
 		if v1 < v2 {
-			return Value(1)
+			return Value(1), nil
 		}
-		return Value(0)
+		return Value(0), nil
 	case Or:
 		if v1 != Value(0) || v2 != Value(0) {
-			return Value(1)
+			return Value(1), nil
 		}
-		return Value(0)
+		return Value(0), nil
 	case And:
 		if v1 != Value(0) && v2 != Value(0) {
-			return Value(1)
+			return Value(1), nil
 		}
-		return Value(0)
+		return Value(0), nil
 	case Equal:
 		if v1 == v2 {
-			return Value(1)
+			return Value(1), nil
 		}
-		return Value(0)
+		return Value(0), nil
 	}
 	panic("Unknown op")
 }
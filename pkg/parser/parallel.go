@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// workers bounds the number of extra goroutines an evaluation may use. A nil workers evaluates sequentially
+type workers chan struct{}
+
+func newWorkers(n int) workers {
+	if n <= 1 {
+		return nil
+	}
+	// the calling goroutine is one of the workers
+	return make(workers, n-1)
+}
+
+func (w workers) acquire() bool {
+	select {
+	case w <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (w workers) release() {
+	<-w
+}
+
+// Result is the result of one evaluation in a batch
+type Result struct {
+	Value Value
+	Err   error
+}
+
+// recovered turns a panic on a worker goroutine into an error, as the caller cannot recover it
+func recovered(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("Evaluation panicked: %v", r)
+	}
+}
+
+// parallel runs the functions, handing each to a free worker if there is one and otherwise
+// running it on the calling goroutine. It returns the first error in order of the functions
+func (e *evaluation) parallel(fns ...func(*evaluation) error) error {
+	errs := make([]error, len(fns))
+	wg := sync.WaitGroup{}
+	for i, fn := range fns {
+		if i < len(fns)-1 && e.workers != nil && e.workers.acquire() {
+			wg.Add(1)
+			go func(i int, fn func(*evaluation) error, f *evaluation) {
+				defer wg.Done()
+				defer e.workers.release()
+				defer recovered(&errs[i])
+				errs[i] = fn(f)
+			}(i, fn, e.fork())
+			continue
+		}
+		errs[i] = fn(e)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// split returns whether the expressions are worth evaluating in parallel: more than one of them
+// makes calls, and every call is pure. Go functions and hooks may depend on the order of calls,
+// so evaluations using them stay sequential
+func (e *evaluation) split(context Context, exps ...*Expression) bool {
+	if e.workers == nil || e.hook != nil {
+		return false
+	}
+	calls := 0
+	for _, exp := range exps {
+		pure, called := e.pureCalls(exp, context)
+		if !pure {
+			return false
+		} else if called {
+			calls++
+		}
+	}
+	return calls > 1
+}
+
+// pureCalls returns whether every call in the expression is pure, and whether it has a call
+func (e *evaluation) pureCalls(exp *Expression, context Context) (pure, called bool) {
+	if exp == nil {
+		return true, false
+	}
+	subs := []*Expression{exp.Left, exp.Right}
+	if exp.Functional != nil {
+		if !e.purity.call(exp.Functional.Name, context) {
+			return false, true
+		}
+		called = true
+		subs = append(subs, exp.Functional.Inputs...)
+	}
+	if exp.Conditional != nil {
+		subs = append(subs, exp.Conditional.Predicate, exp.Conditional.True, exp.Conditional.False)
+	}
+	for _, sub := range subs {
+		p, c := e.pureCalls(sub, context)
+		if !p {
+			return false, true
+		}
+		called = called || c
+	}
+	return true, called
+}
+
+// purity finds which calls are pure: calls of builtins, and of `let` functions making only pure
+// calls. It caches the functions it has checked, and is shared by the forks of an evaluation
+type purity struct {
+	lock  sync.Mutex
+	funcs map[*Function]bool
+}
+
+func newPurity() *purity {
+	return &purity{funcs: make(map[*Function]bool)}
+}
+
+// call returns whether a call of the name in the context is pure
+func (p *purity) call(name string, context Context) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.check(name, context, map[*Function]bool{})
+}
+
+// check returns whether a call of the name is pure, taking functions being checked to be pure.
+// Only the result of the outermost function is cached, as the others may depend on it
+func (p *purity) check(name string, context Context, checking map[*Function]bool) bool {
+	v, ok := context[name]
+	if ok && v.Builtin != nil {
+		return false
+	} else if !ok || v.Function == nil {
+		_, ok = builtins[name]
+		return ok
+	}
+	f := v.Function
+	if pure, ok := p.funcs[f]; ok {
+		return pure
+	} else if checking[f] {
+		return true
+	}
+	checking[f] = true
+	if f.Scope != nil {
+		context = f.Scope
+	}
+	pure := true
+	for _, callee := range f.calls() {
+		if pure = p.check(callee, context, checking); !pure {
+			break
+		}
+	}
+	if len(checking) == 1 {
+		p.funcs[f] = pure
+	}
+	delete(checking, f)
+	return pure
+}
+
+// EvaluateParallel evaluates the tree within the limits, evaluating independent function calls
+// on up to the given number of goroutines
+func (a *AST) EvaluateParallel(ctx context.Context, limits Limits, n int, table map[string]ContextVar) (*Expression, error) {
+	e := newEvaluation(ctx, limits)
+	e.workers = newWorkers(n)
+	return a.Root.eval(e, table)
+}
+
+// EvaluateBatch fully evaluates the tree once for each table, using a goroutine per cpu
+func EvaluateBatch(a *AST, tables []Context) []Result {
+	return EvaluateBatchContext(context.Background(), a, Limits{}, runtime.NumCPU(), tables)
+}
+
+// EvaluateBatchContext fully evaluates the tree once for each table on up to the given number of
+// goroutines. The limits apply to each evaluation separately, and a row failing or panicking
+// only sets the error of its result
+func EvaluateBatchContext(ctx context.Context, a *AST, limits Limits, n int, tables []Context) []Result {
+	results := make([]Result, len(tables))
+	if n < 1 {
+		n = 1
+	}
+	jobs := make(chan int)
+	wg := sync.WaitGroup{}
+	for w := 0; w < n; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = evaluateRow(ctx, a, limits, tables[i])
+			}
+		}()
+	}
+	for i := range tables {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// evaluateRow fully evaluates the tree for one row of a batch
+func evaluateRow(ctx context.Context, a *AST, limits Limits, table Context) (res Result) {
+	res.Value = -1
+	defer recovered(&res.Err)
+	val, err := a.evaluateFull(newEvaluation(ctx, limits), table)
+	if err != nil {
+		return Result{Value: -1, Err: err}
+	}
+	return Result{Value: Value(val)}
+}
@@ -0,0 +1,164 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// concurrency is a go function that records how many of its calls run at once
+type concurrency struct {
+	lock      sync.Mutex
+	active    int
+	maxActive int
+}
+
+func (c *concurrency) fn(args []Value) (Value, error) {
+	c.lock.Lock()
+	c.active++
+	if c.active > c.maxActive {
+		c.maxActive = c.active
+	}
+	c.lock.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	c.lock.Lock()
+	c.active--
+	c.lock.Unlock()
+	return args[0], nil
+}
+
+func TestBatchWithOneWorkerIsSequential(t *testing.T) {
+	r := NewRuntime()
+	r.Workers = 1
+	c := &concurrency{}
+	if err := r.RegisterFunc("host", 1, c.fn); err != nil {
+		t.Fatal(err)
+	}
+	rows := []Context{}
+	for i := 0; i < 8; i++ {
+		v := Value(i)
+		rows = append(rows, Context{"x": FromValue(&v)})
+	}
+	results, err := r.EvalBatch(context.Background(), "host(x) + 1", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, res := range results {
+		if res.Err != nil || res.Value != Value(i+1) {
+			t.Errorf("row %d: %d, %v", i, res.Value, res.Err)
+		}
+	}
+	if c.maxActive != 1 {
+		t.Errorf("%d calls ran at once with one worker", c.maxActive)
+	}
+}
+
+func TestGoFunctionsAreNotEvaluatedInParallel(t *testing.T) {
+	r := NewRuntime()
+	r.Workers = 4
+	c := &concurrency{}
+	if err := r.RegisterFunc("host", 1, c.fn); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Define("let viahost x = host(x) * 2"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := r.Eval("host(1) + host(2) + viahost(3) + viahost(4)")
+	if err != nil || v != 17 {
+		t.Fatalf("expected 17, got %d, %v", v, err)
+	}
+	if c.maxActive != 1 {
+		t.Errorf("%d calls of a go function ran at once", c.maxActive)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	ctx := NewContext()
+	if err := ctx.RegisterFunc("host", 1, func(args []Value) (Value, error) { return args[0], nil }); err != nil {
+		t.Fatal(err)
+	}
+	for _, src := range []string{"let sq x = x * x", "let viahost x = host(x)", "let ev n = if n = 0 then 1 else od(n - 1)", "let od n = if n = 0 then 0 else ev(n - 1)"} {
+		f, err := ParseFunction(src, ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ctx[*f.Name] = FromFunc(f)
+	}
+	cases := []struct {
+		left, right string
+		split       bool
+	}{
+		{"sq(1)", "sq(2)", true},
+		{"abs(1)", "ev(2)", true},
+		{"sq(1)", "2", false},
+		{"sq(1)", "host(2)", false},
+		{"sq(1)", "viahost(2)", false},
+		{"sq(host(1))", "sq(2)", false},
+		{"nothere(1)", "sq(2)", false},
+	}
+	for _, c := range cases {
+		l, err := Parse(c.left)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := Parse(c.right)
+		if err != nil {
+			t.Fatal(err)
+		}
+		e := newEvaluation(nil, Limits{})
+		e.workers = newWorkers(2)
+		if got := e.split(ctx, l.Root, r.Root); got != c.split {
+			t.Errorf("split(%s, %s) = %v, expected %v", c.left, c.right, got, c.split)
+		}
+		e.hook = NewTracer(nil)
+		if e.split(ctx, l.Root, r.Root) {
+			t.Errorf("split(%s, %s) with a hook", c.left, c.right)
+		}
+	}
+}
+
+func TestBatchRowFailures(t *testing.T) {
+	r := NewRuntime()
+	r.Workers = 4
+	if err := r.RegisterFunc("host", 1, func(args []Value) (Value, error) {
+		if args[0] < 0 {
+			panic("negative input")
+		}
+		return args[0], nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	rows := []Context{}
+	for _, i := range []Value{5, 0, -1, 2} {
+		v := i
+		rows = append(rows, Context{"x": FromValue(&v)})
+	}
+	results, err := r.EvalBatch(context.Background(), "10 / host(x)", rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Err != nil || results[0].Value != 2 || results[3].Err != nil || results[3].Value != 5 {
+		t.Errorf("expected 2 and 5, got %+v and %+v", results[0], results[3])
+	}
+	if !errors.Is(results[1].Err, ErrDivisionByZero) {
+		t.Errorf("expected division by zero, got %+v", results[1])
+	}
+	if results[2].Err == nil || !strings.Contains(results[2].Err.Error(), "negative input") {
+		t.Errorf("expected the panic as an error, got %+v", results[2])
+	}
+}
+
+func TestParallelRecoversWorkers(t *testing.T) {
+	e := newEvaluation(nil, Limits{})
+	e.workers = newWorkers(2)
+	err := e.parallel(
+		func(*evaluation) error { panic("in a worker") },
+		func(*evaluation) error { return nil },
+	)
+	if err == nil || !strings.Contains(err.Error(), "in a worker") {
+		t.Fatalf("expected the panic as an error, got %v", err)
+	}
+}
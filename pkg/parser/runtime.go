@@ -0,0 +1,273 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Runtime owns an environment and evaluates source against it. It is safe for concurrent
+// use, with each evaluation running against a snapshot of the environment
+type Runtime struct {
+	Environment *Environment
+	// Limits bounds each evaluation. It should be set before the runtime is shared
+	Limits Limits
+	// Workers is the number of goroutines each evaluation or batch may use. One evaluates
+	// sequentially. Zero evaluates expressions sequentially and batches on a goroutine per cpu
+	Workers int
+	// Hook observes each evaluation if it is set. It should be set before the runtime is shared
+	Hook EvalHook
+	// SearchPath are the directories searched for modules that are not found relative to the importing file
+	SearchPath []string
+
+	lock    sync.Mutex
+	imports []string
+}
+
+// NewRuntime creates a new runtime with an empty environment
+func NewRuntime() *Runtime {
+	return &Runtime{
+		Environment: NewEnvironment(nil),
+	}
+}
+
+// Define parses the `let` definition and adds it to the environment
+func (r *Runtime) Define(src string) (*Function, error) {
+	return r.define(src, false, 0, "")
+}
+
+// DefineStatement is Define for a statement read from source, keeping its line and doc
+func (r *Runtime) DefineStatement(stmt Statement) (*Function, error) {
+	return r.define(stmt.Source, false, stmt.Line, stmt.Doc)
+}
+
+// Override parses the `let` definition and adds it to the environment, replacing a builtin with the same name
+func (r *Runtime) Override(src string) (*Function, error) {
+	return r.define(src, true, 0, "")
+}
+
+func (r *Runtime) define(src string, override bool, line int, doc string) (*Function, error) {
+	var f *Function
+	err := r.Environment.Update(func(ctx Context) (err error) {
+		f, err = defineIn(ctx, Statement{Source: src, Line: line, Doc: doc}, override)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// DefineStatements defines each of the `let` statements in order, in a single update of the
+// environment. If a statement fails, the functions before it stay defined and are returned
+// with its error
+func (r *Runtime) DefineStatements(stmts []Statement) ([]*Function, error) {
+	ret := []*Function{}
+	var failed error
+	r.Environment.Update(func(ctx Context) error {
+		for _, stmt := range stmts {
+			f, err := defineIn(ctx, stmt, false)
+			if err != nil {
+				failed = err
+				break
+			}
+			ret = append(ret, f)
+		}
+		return nil
+	})
+	return ret, failed
+}
+
+// defineIn parses the definition against the context and adds it to the context
+func defineIn(ctx Context, stmt Statement, override bool) (*Function, error) {
+	f, err := ParseFunction(stmt.Source, ctx)
+	if err != nil {
+		return nil, err
+	}
+	f.Line = stmt.Line
+	f.Doc = stmt.Doc
+	if f.Name == nil {
+		return nil, fmt.Errorf("Cannot map anonymous function")
+	}
+	if ctx.IsBuiltin(*f.Name) && !override {
+		return nil, fmt.Errorf("Cannot redefine builtin function `%s`", *f.Name)
+	}
+	ctx[*f.Name] = FromFunc(f)
+	return f, nil
+}
+
+// LeadingDefinitions returns the `let` statements at the start of the statements
+func LeadingDefinitions(stmts []Statement) []Statement {
+	n := 0
+	for n < len(stmts) && IsDefinition(stmts[n].Source) {
+		n++
+	}
+	return stmts[:n]
+}
+
+// Eval parses and fully evaluates the expression
+func (r *Runtime) Eval(src string) (Value, error) {
+	return r.EvalContext(context.Background(), src)
+}
+
+// EvalContext parses and fully evaluates the expression, stopping when ctx is done
+func (r *Runtime) EvalContext(ctx context.Context, src string) (Value, error) {
+	a, err := Parse(strings.TrimSpace(src))
+	if err != nil {
+		return -1, err
+	}
+	return r.EvalTree(ctx, a, r.Environment.Snapshot())
+}
+
+// EvalTree fully evaluates the parsed expression in the context, which is usually a snapshot
+// of the environment, stopping when ctx is done
+func (r *Runtime) EvalTree(ctx context.Context, a *AST, vars Context) (Value, error) {
+	val, err := a.evaluateFull(r.evaluation(ctx), vars)
+	if err != nil {
+		return -1, err
+	}
+	return Value(val), nil
+}
+
+// EvalBatch parses the expression and fully evaluates it once for each row of inputs, with
+// the inputs of a row taking precedence over the environment
+func (r *Runtime) EvalBatch(ctx context.Context, src string, rows []Context) ([]Result, error) {
+	a, err := Parse(strings.TrimSpace(src))
+	if err != nil {
+		return nil, err
+	}
+	global := r.Environment.Snapshot()
+	tables := make([]Context, 0, len(rows))
+	for _, row := range rows {
+		tables = append(tables, StitchContext(row, global))
+	}
+	n := r.Workers
+	if n < 1 {
+		n = runtime.NumCPU()
+	}
+	return EvaluateBatchContext(ctx, a, r.Limits, n, tables), nil
+}
+
+// Explain parses the expression and reduces it one rewrite at a time against the environment
+func (r *Runtime) Explain(src string) ([]*Expression, error) {
+	a, err := Parse(strings.TrimSpace(src))
+	if err != nil {
+		return nil, err
+	}
+	return a.Root.explain(r.evaluation(context.Background()), r.Environment.Snapshot())
+}
+
+// TypeOf infers the type of the expression in the environment without evaluating it. A
+// function name has the type of the function
+func (r *Runtime) TypeOf(src string) (string, error) {
+	a, err := Parse(strings.TrimSpace(src))
+	if err != nil {
+		return "", err
+	}
+	t, err := r.Environment.Snapshot().InferExpression(a.Root)
+	if err != nil {
+		return "", err
+	}
+	return t.String(), nil
+}
+
+// Call calls the named function with the given inputs
+func (r *Runtime) Call(name string, args ...Value) (Value, error) {
+	return r.CallContext(context.Background(), name, args...)
+}
+
+// CallContext calls the named function with the given inputs, stopping when ctx is done
+func (r *Runtime) CallContext(ctx context.Context, name string, args ...Value) (Value, error) {
+	inputs := make([]ContextVar, 0, len(args))
+	for i := range args {
+		inputs = append(inputs, FromValue(&args[i]))
+	}
+	return call(r.evaluation(ctx), r.Environment.Snapshot(), name, inputs...)
+}
+
+// evaluation starts an evaluation with the limits, workers and hook of the runtime
+func (r *Runtime) evaluation(ctx context.Context) *evaluation {
+	e := newEvaluation(ctx, r.Limits)
+	e.workers = newWorkers(r.Workers)
+	e.hook = r.Hook
+	return e
+}
+
+// Load reads source line by line, defining each `let`, running each import relative to the
+// working directory and evaluating each other expression. Statements may span several lines.
+// Module and export declarations only apply to files loaded by an import, and are skipped
+func (r *Runtime) Load(reader io.Reader) error {
+	stmts, err := ReadStatements(reader)
+	if err != nil {
+		return err
+	}
+	for n := 0; n < len(stmts); n++ {
+		stmt := stmts[n]
+		if defs := LeadingDefinitions(stmts[n:]); len(defs) > 0 {
+			// runs of definitions are defined in one update, so the environment is copied once
+			fns, err := r.DefineStatements(defs)
+			if err != nil {
+				return fmt.Errorf("Line %d: %v", stmts[n+len(fns)].Line, err)
+			}
+			n += len(defs) - 1
+			continue
+		}
+		if IsModuleDeclaration(stmt.Source) {
+			continue
+		} else if IsImport(stmt.Source) {
+			_, err = r.Import(stmt.Source, "")
+		} else {
+			_, err = r.Eval(stmt.Source)
+		}
+		if err != nil {
+			return fmt.Errorf("Line %d: %v", stmt.Line, err)
+		}
+	}
+	return nil
+}
+
+// RegisterFunc registers a go function in the environment
+func (r *Runtime) RegisterFunc(name string, arity int, fn func(args []Value) (Value, error)) error {
+	return r.Environment.Update(func(ctx Context) error {
+		return ctx.RegisterFunc(name, arity, fn)
+	})
+}
+
+// OverrideFunc registers a go function in the environment, replacing a builtin or definition with the same name
+func (r *Runtime) OverrideFunc(name string, arity int, fn func(args []Value) (Value, error)) error {
+	return r.Environment.Update(func(ctx Context) error {
+		return ctx.OverrideFunc(name, arity, fn)
+	})
+}
+
+// Snapshot returns a copy of the environment
+func (r *Runtime) Snapshot() Context {
+	return r.Environment.Snapshot().Clone()
+}
+
+// Clear removes all definitions from the environment, keeping registered go functions
+func (r *Runtime) Clear() {
+	r.lock.Lock()
+	r.imports = nil
+	r.lock.Unlock()
+	r.Environment.Update(func(ctx Context) error {
+		for k, v := range ctx {
+			if v.Builtin == nil {
+				delete(ctx, k)
+			}
+		}
+		return nil
+	})
+}
+
+// IsDefinition returns whether the source is a `let` definition, matching the keyword the same
+// way as ParseFunction
+func IsDefinition(src string) bool {
+	runes := []rune(strings.TrimLeftFunc(StripComments(src), unicode.IsSpace))
+	n := len([]rune(KeywordLet))
+	return len(runes) > n && strings.EqualFold(string(runes[:n]), KeywordLet) && unicode.IsSpace(runes[n])
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Statement is a statement of source, which may span several lines
+type Statement struct {
+	Source string
+	// Line and EndLine are the first and last lines of the statement, starting at 1
+	Line    int
+	EndLine int
+	// Doc is the text of the comments on the lines just before a `let` definition
+	Doc string
+
+	// lines are the lines of the statement as written
+	lines []string
+}
+
+// ReadStatements reads the source line by line, joining continuation lines onto the statement
+// they continue. A line starting a `let`, import, module or export statement always starts a
+// new statement, so an unfinished statement such as one with an unclosed parenthesis ends
+// before it. Empty lines are skipped, and comments on lines of their own are attached as the
+// doc of a `let` definition that directly follows them
+func ReadStatements(reader io.Reader) ([]Statement, error) {
+	return readStatements(reader, false)
+}
+
+// readStatements reads the statements of the source, including statements that are only
+// comments if comments is set
+func readStatements(reader io.Reader, comments bool) ([]Statement, error) {
+	scanner := bufio.NewScanner(reader)
+	ret := []Statement{}
+	line := 0
+	stmt := Statement{}
+	doc := []string{}
+	add := func() {
+		if isComment(stmt.Source) {
+			doc = append(doc, Comments(strings.Join(stmt.lines, "\n"))...)
+			if comments {
+				ret = append(ret, stmt)
+			}
+			return
+		}
+		if IsDefinition(stmt.Source) {
+			stmt.Doc = strings.Join(doc, "\n")
+		}
+		doc = []string{}
+		ret = append(ret, stmt)
+	}
+	for scanner.Scan() {
+		line++
+		if len(stmt.Source) > 0 && !inComment(stmt.Source) && startsStatement(scanner.Text()) {
+			add()
+			stmt = Statement{}
+		}
+		if len(stmt.Source) == 0 {
+			stmt = Statement{Source: strings.TrimSpace(scanner.Text()), Line: line}
+		} else {
+			stmt.Source = JoinLines(stmt.Source, scanner.Text())
+		}
+		stmt.EndLine = line
+		stmt.lines = append(stmt.lines, scanner.Text())
+		if len(stmt.Source) == 0 {
+			doc = []string{}
+			stmt = Statement{}
+			continue
+		}
+		if Incomplete(stmt.Source) {
+			continue
+		}
+		add()
+		stmt = Statement{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stmt.Source) > 0 {
+		add()
+	}
+	return ret, nil
+}
+
+// isComment returns whether the source is only comments
+func isComment(src string) bool {
+	return len(strings.TrimSpace(src)) > 0 && len(strings.TrimSpace(StripComments(src))) == 0
+}
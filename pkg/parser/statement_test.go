@@ -0,0 +1,45 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadStatements(t *testing.T) {
+	src := strings.Join([]string{
+		"let f x = (x +",
+		"  1)",
+		"let g x = (x + 1",
+		"let h x = x",
+		"/* let i x = x",
+		"*/ f(1) +",
+		"  2",
+		"import \"m\" as m",
+	}, "\n")
+	stmts, err := ReadStatements(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		line, end int
+	}{{1, 2}, {3, 3}, {4, 4}, {5, 7}, {8, 8}}
+	if len(stmts) != len(want) {
+		t.Fatalf("expected %d statements, got %d: %v", len(want), len(stmts), stmts)
+	}
+	for i, w := range want {
+		if stmts[i].Line != w.line || stmts[i].EndLine != w.end {
+			t.Errorf("statement %d: expected lines %d-%d, got %d-%d", i, w.line, w.end, stmts[i].Line, stmts[i].EndLine)
+		}
+	}
+}
+
+func TestLoadReportsUnclosedParenthesis(t *testing.T) {
+	r := NewRuntime()
+	err := r.Load(strings.NewReader("let f x = x\nlet g x = (x + 1\nlet h x = x\n"))
+	if err == nil || !strings.HasPrefix(err.Error(), "Line 2:") {
+		t.Errorf("expected an error on line 2, got %v", err)
+	}
+	if _, ok := r.Environment.Get("f"); !ok {
+		t.Error("f before the error is not defined")
+	}
+}
@@ -12,7 +12,9 @@ func parseSymbol(runes []rune, startIdx int) (*Expression, int, error) {
 	idx := 0
 	for i, r := range runes {
 		idx = i
-		if unicode.IsLetter(r) {
+		if IsIdentifierRune(r) {
+			continue
+		} else if isQualifier(runes, i) {
 			continue
 		} else if unicode.IsSpace(r) {
 			break
@@ -24,10 +26,10 @@ func parseSymbol(runes []rune, startIdx int) (*Expression, int, error) {
 			return nil, -1, invalidSymbolError(r, startIdx+i)
 		}
 	}
-	if idx == len(runes)-1 && unicode.IsLetter(runes[idx]) {
+	if idx == len(runes)-1 && IsIdentifierRune(runes[idx]) {
 		idx = len(runes)
 	}
-	e := &Expression{}
+	e := &Expression{Index: startIdx}
 	sym := Symbol(string(runes[:idx]))
 	if isReserved(string(sym)) {
 		return nil, -1, fmt.Errorf("Invalid identifier. `%s` is a reserved word", string(sym))
@@ -35,3 +37,9 @@ func parseSymbol(runes []rune, startIdx int) (*Expression, int, error) {
 	e.Symbol = &sym
 	return e, idx, nil
 }
+
+// isQualifier returns whether the rune at i separates a qualifier from a name, as in g.area
+func isQualifier(runes []rune, i int) bool {
+	return string(runes[i]) == QualifierSeparator && i > 0 && IsIdentifierRune(runes[i-1]) &&
+		i+1 < len(runes) && IsIdentifierRune(runes[i+1])
+}
@@ -0,0 +1,423 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TypeInt is the type of every value
+const TypeInt = "int"
+
+// Type is an inferred type. It is int, a type variable, or a function of its inputs to its result
+type Type struct {
+	// Var numbers a type variable from 1, and is 0 for other types
+	Var int
+	// Inputs and Result are set for function types
+	Inputs []*Type
+	Result *Type
+	// Variadic marks a function of one or more inputs of the type of its only input
+	Variadic bool
+
+	// bound is the type a variable is unified with
+	bound *Type
+}
+
+// String returns the type with its variables named a, b, c and so on in order of appearance
+func (t *Type) String() string {
+	return t.format(map[*Type]string{})
+}
+
+func (t *Type) format(names map[*Type]string) string {
+	t = t.resolve()
+	switch {
+	case t.Var > 0:
+		if _, ok := names[t]; !ok {
+			names[t] = typeVarName(len(names))
+		}
+		return names[t]
+	case t.Result == nil:
+		return TypeInt
+	}
+	inputs := make([]string, 0, len(t.Inputs)+1)
+	for _, input := range t.Inputs {
+		inputs = append(inputs, input.format(names))
+	}
+	if t.Variadic {
+		inputs = append(inputs, "...")
+	}
+	return "func(" + strings.Join(inputs, ",") + ") -> " + t.Result.format(names)
+}
+
+func typeVarName(n int) string {
+	name := string(rune('a' + n%26))
+	if n >= 26 {
+		name += fmt.Sprint(n / 26)
+	}
+	return name
+}
+
+// resolve follows the bindings of a variable to the type it is unified with
+func (t *Type) resolve() *Type {
+	for t.Var > 0 && t.bound != nil {
+		t = t.bound
+	}
+	return t
+}
+
+// resolved returns a copy of the type without bindings, with its variables numbered from 1
+func (t *Type) resolved() *Type {
+	vars := map[*Type]*Type{}
+	var copy func(t *Type) *Type
+	copy = func(t *Type) *Type {
+		t = t.resolve()
+		switch {
+		case t.Var > 0:
+			if _, ok := vars[t]; !ok {
+				vars[t] = &Type{Var: len(vars) + 1}
+			}
+			return vars[t]
+		case t.Result == nil:
+			return &Type{}
+		}
+		ret := &Type{Variadic: t.Variadic}
+		for _, input := range t.Inputs {
+			ret.Inputs = append(ret.Inputs, copy(input))
+		}
+		ret.Result = copy(t.Result)
+		return ret
+	}
+	return copy(t)
+}
+
+// occurs returns whether the variable occurs in the type
+func (t *Type) occurs(v *Type) bool {
+	t = t.resolve()
+	if t == v {
+		return true
+	}
+	for _, input := range t.Inputs {
+		if input.occurs(v) {
+			return true
+		}
+	}
+	return t.Result != nil && t.Result.occurs(v)
+}
+
+// builtinType returns the type of a builtin of the arity, taking one or more ints if it is negative
+func builtinType(arity int) *Type {
+	if arity < 0 {
+		return &Type{Inputs: []*Type{{}}, Result: &Type{}, Variadic: true}
+	}
+	t := &Type{Inputs: make([]*Type, arity), Result: &Type{}}
+	for i := range t.Inputs {
+		t.Inputs[i] = &Type{}
+	}
+	return t
+}
+
+// Infer infers the type of the function, with its calls resolved in the context, or in the
+// context of its module if it is imported. Inputs that may have any type have type variables
+func (c Context) Infer(f *Function) (*Type, error) {
+	t, err := newChecker().function(f, c)
+	if err != nil {
+		return nil, err
+	}
+	return t.resolved(), nil
+}
+
+// InferExpression infers the type of the expression in the context. Symbols that are not
+// defined have type variables
+func (c Context) InferExpression(exp *Expression) (*Type, error) {
+	ch := newChecker()
+	t, err := ch.infer(exp, &typeScope{context: c})
+	if err != nil {
+		return nil, err
+	}
+	return t.resolved(), nil
+}
+
+// checker infers types by unification, as in Hindley-Milner type inference. Each function has
+// a polymorphic type, so every call instantiates fresh variables for it, except calls made
+// while its own type is still being inferred
+type checker struct {
+	vars       int
+	signatures map[*Function]*Type
+	failed     map[*Function]error
+	inferring  map[*Function]*Type
+}
+
+// typeScope is where names in an expression are resolved: the inputs and name of the function
+// being inferred, then the context
+type typeScope struct {
+	context Context
+	inputs  map[string]*Type
+	name    string
+	self    *Type
+}
+
+func newChecker() *checker {
+	return &checker{
+		signatures: make(map[*Function]*Type),
+		failed:     make(map[*Function]error),
+		inferring:  make(map[*Function]*Type),
+	}
+}
+
+func (ch *checker) fresh() *Type {
+	ch.vars++
+	return &Type{Var: ch.vars}
+}
+
+// function infers the type of the function, caching it for later calls
+func (ch *checker) function(f *Function, context Context) (*Type, error) {
+	if t, ok := ch.signatures[f]; ok {
+		return t, nil
+	} else if t, ok := ch.inferring[f]; ok {
+		return t, nil
+	} else if err, ok := ch.failed[f]; ok {
+		return nil, err
+	}
+	if f.Scope != nil {
+		context = f.Scope
+	}
+	t := &Type{Result: ch.fresh()}
+	s := &typeScope{context: context, inputs: make(map[string]*Type), self: t}
+	for _, input := range f.Inputs {
+		v := ch.fresh()
+		t.Inputs = append(t.Inputs, v)
+		s.inputs[input] = v
+	}
+	if f.Name != nil {
+		s.name = *f.Name
+	}
+	ch.inferring[f] = t
+	defer delete(ch.inferring, f)
+	result, err := ch.infer(f.Body.Root, s)
+	if err == nil {
+		err = ch.value(result, f.Body.Root)
+	}
+	if err == nil {
+		err = ch.expect(result, t.Result, f.Body.Root)
+	}
+	if err != nil {
+		ch.failed[f] = err
+		return nil, err
+	}
+	ch.signatures[f] = t
+	return t, nil
+}
+
+// callee returns the type of the function with the name, resolved the way a call is, or nil if
+// the function is not defined yet
+func (ch *checker) callee(name string, s *typeScope, at *Expression) (*Type, error) {
+	_, input := s.inputs[name]
+	v, ok := s.context[name]
+	switch {
+	case !input && len(s.name) > 0 && name == s.name:
+		return s.self, nil
+	case !input && ok && v.Function != nil:
+		t, err := ch.function(v.Function, s.context)
+		if err != nil {
+			// a function that does not type check is reported where it is defined
+			return nil, nil
+		}
+		return ch.instantiate(t), nil
+	case !input && ok && v.Builtin != nil:
+		return builtinType(v.Builtin.Arity), nil
+	}
+	if b, found := builtins[name]; found && !input && !ok {
+		return builtinType(b.Arity), nil
+	} else if input || ok {
+		return nil, fmt.Errorf("Cannot call `%s` at index %d of expression. It is not a function", name, at.Index)
+	}
+	return nil, nil
+}
+
+// symbol returns the type of the symbol with the name
+func (ch *checker) symbol(name string, s *typeScope, at *Expression) (*Type, error) {
+	if t, ok := s.inputs[name]; ok {
+		return t, nil
+	}
+	if v, ok := s.context[name]; ok && v.Value != nil {
+		return &Type{}, nil
+	} else if ok && v.Symbol != nil {
+		return ch.fresh(), nil
+	}
+	t, err := ch.callee(name, s, at)
+	if err != nil || t == nil {
+		return ch.fresh(), err
+	}
+	return t, nil
+}
+
+func (ch *checker) infer(exp *Expression, s *typeScope) (*Type, error) {
+	t, err := ch.node(exp, s)
+	if err != nil {
+		return nil, err
+	}
+	if exp.Negate {
+		if err := ch.expect(t, &Type{}, exp); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (ch *checker) node(exp *Expression, s *typeScope) (*Type, error) {
+	switch {
+	case exp.Val != nil:
+		return &Type{}, nil
+	case exp.Symbol != nil:
+		return ch.symbol(string(*exp.Symbol), s, exp)
+	case exp.Conditional != nil:
+		return ch.conditional(exp.Conditional, s)
+	case exp.Functional != nil:
+		return ch.call(exp, s)
+	}
+	for _, side := range []*Expression{exp.Left, exp.Right} {
+		if side == nil {
+			continue
+		}
+		t, err := ch.infer(side, s)
+		if err != nil {
+			return nil, err
+		}
+		if err := ch.expect(t, &Type{}, side); err != nil {
+			return nil, err
+		}
+	}
+	return &Type{}, nil
+}
+
+func (ch *checker) conditional(c *Conditional, s *typeScope) (*Type, error) {
+	pred, err := ch.infer(c.Predicate, s)
+	if err != nil {
+		return nil, err
+	}
+	if err := ch.expect(pred, &Type{}, c.Predicate); err != nil {
+		return nil, err
+	}
+	t, err := ch.infer(c.True, s)
+	if err == nil {
+		err = ch.value(t, c.True)
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := ch.infer(c.False, s)
+	if err == nil {
+		err = ch.value(f, c.False)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, ch.expect(f, t, c.False)
+}
+
+func (ch *checker) call(exp *Expression, s *typeScope) (*Type, error) {
+	name := exp.Functional.Name
+	args := make([]*Type, 0, len(exp.Functional.Inputs))
+	for _, input := range exp.Functional.Inputs {
+		t, err := ch.infer(input, s)
+		if err == nil {
+			err = ch.value(t, input)
+		}
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, t)
+	}
+	f, err := ch.callee(name, s, exp)
+	if err != nil {
+		return nil, err
+	}
+	if f == nil {
+		return ch.fresh(), nil
+	}
+	f = f.resolve()
+	if f.Variadic && len(args) == 0 {
+		return nil, fmt.Errorf("Missing inputs for `%s` at index %d of expression. Expected at least 1 input", name, exp.Index)
+	} else if !f.Variadic && len(args) != len(f.Inputs) {
+		return nil, fmt.Errorf("Wrong number of inputs for `%s` at index %d of expression. Expected %d inputs, found %d", name, exp.Index, len(f.Inputs), len(args))
+	}
+	for i, arg := range args {
+		want := f.Inputs[0]
+		if !f.Variadic {
+			want = f.Inputs[i]
+		}
+		if err := ch.expect(arg, want, exp.Functional.Inputs[i]); err != nil {
+			return nil, err
+		}
+	}
+	return f.Result, nil
+}
+
+// value checks that the expression is not a function. Functions are called by name, but
+// never passed to or returned from a function
+func (ch *checker) value(t *Type, at *Expression) error {
+	if t.resolve().Result != nil {
+		return fmt.Errorf("Type mismatch at index %d of expression. Expected a value, found %s", at.Index, t)
+	}
+	return nil
+}
+
+// expect unifies the type found for the expression with the type it must have
+func (ch *checker) expect(found, want *Type, at *Expression) error {
+	if ch.unify(found, want) {
+		return nil
+	}
+	names := map[*Type]string{}
+	w := want.format(names)
+	return fmt.Errorf("Type mismatch at index %d of expression. Expected %s, found %s", at.Index, w, found.format(names))
+}
+
+func (ch *checker) unify(a, b *Type) bool {
+	a, b = a.resolve(), b.resolve()
+	switch {
+	case a == b:
+		return true
+	case a.Var > 0:
+		if b.occurs(a) {
+			return false
+		}
+		a.bound = b
+		return true
+	case b.Var > 0:
+		return ch.unify(b, a)
+	case a.Result == nil || b.Result == nil:
+		return a.Result == nil && b.Result == nil
+	case a.Variadic != b.Variadic || len(a.Inputs) != len(b.Inputs):
+		return false
+	}
+	for i := range a.Inputs {
+		if !ch.unify(a.Inputs[i], b.Inputs[i]) {
+			return false
+		}
+	}
+	return ch.unify(a.Result, b.Result)
+}
+
+// instantiate copies the type with fresh variables for its free variables
+func (ch *checker) instantiate(t *Type) *Type {
+	vars := map[*Type]*Type{}
+	var copy func(t *Type) *Type
+	copy = func(t *Type) *Type {
+		t = t.resolve()
+		switch {
+		case t.Var > 0:
+			if _, ok := vars[t]; !ok {
+				vars[t] = ch.fresh()
+			}
+			return vars[t]
+		case t.Result == nil:
+			return t
+		}
+		ret := &Type{Variadic: t.Variadic}
+		for _, input := range t.Inputs {
+			ret.Inputs = append(ret.Inputs, copy(input))
+		}
+		ret.Result = copy(t.Result)
+		return ret
+	}
+	return copy(t)
+}
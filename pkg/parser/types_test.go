@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"strings"
+	"testing"
+)
+
+// typeContext defines the functions in order in a new context
+func typeContext(t *testing.T, defs ...string) Context {
+	t.Helper()
+	ctx := NewContext()
+	for _, def := range defs {
+		f, err := ParseFunction(def, ctx)
+		if err != nil {
+			t.Fatalf("%s: %v", def, err)
+		}
+		ctx[*f.Name] = FromFunc(f)
+	}
+	return ctx
+}
+
+func TestInfer(t *testing.T) {
+	ctx := typeContext(t,
+		"let sq x = x * x",
+		"let id x = x",
+		"let apply x y = if x > 0 then y else 0",
+		"let fact n = if n < 2 then 1 else n * fact(n + -1)",
+		"let even n = if n = 0 then 1 else odd(n + -1)",
+		"let odd n = if n = 0 then 0 else even(n + -1)",
+	)
+	for _, tc := range []struct{ name, want string }{
+		{"sq", "func(int) -> int"},
+		{"id", "func(a) -> a"},
+		{"apply", "func(int,int) -> int"},
+		{"fact", "func(int) -> int"},
+		{"even", "func(int) -> int"},
+		{"odd", "func(int) -> int"},
+	} {
+		found, err := ctx.Infer(ctx[tc.name].Function)
+		if err != nil || found.String() != tc.want {
+			t.Errorf("%s: expected %s, found %v %v", tc.name, tc.want, found, err)
+		}
+	}
+}
+
+func TestTypeErrors(t *testing.T) {
+	ctx := typeContext(t, "let sq x = x * x", "let id x = x")
+	for _, tc := range []struct {
+		src, want string
+	}{
+		{"let f x = sq(x, 1)", "Wrong number of inputs for `sq` at index 10 of expression. Expected 1 inputs, found 2"},
+		{"let f x = id(sq)", "Type mismatch at index 13 of expression. Expected a value, found func(int) -> int"},
+		{"let f x = max()", "Missing inputs for `max` at index 10 of expression. Expected at least 1 input"},
+		{"let f x = x(1)", "Cannot call `x` at index 10 of expression. It is not a function"},
+		{"let f sin = sin(sin)", "Cannot call `sin` at index 12 of expression. It is not a function"},
+		{"let f x = if x then sq else 1", "Type mismatch at index 20 of expression. Expected a value, found func(int) -> int"},
+		{"let f x = if x > 0 then f else 1", "Type mismatch at index 24 of expression"},
+	} {
+		_, err := ParseFunction(tc.src, ctx)
+		if err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%s: expected %s, found %v", tc.src, tc.want, err)
+		}
+	}
+}
+
+func TestInferExpression(t *testing.T) {
+	ctx := typeContext(t, "let sq x = x * x")
+	for _, tc := range []struct{ src, want string }{
+		{"sq(2) + 1", "int"},
+		{"sq", "func(int) -> int"},
+		{"y", "a"},
+		{"sq(y) + (1 > 2)", "int"},
+	} {
+		a, err := Parse(tc.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found, err := ctx.InferExpression(a.Root)
+		if err != nil || found.String() != tc.want {
+			t.Errorf("%s: expected %s, found %v %v", tc.src, tc.want, found, err)
+		}
+	}
+	for _, tc := range []struct{ src, want string }{
+		{"1 + sq(2, 3)", "Wrong number of inputs for `sq` at index 4 of expression"},
+		{"1 + sq", "Type mismatch at index 4 of expression. Expected int, found func(int) -> int"},
+		{"if sq then 1 else 2", "Type mismatch at index 3 of expression. Expected int, found func(int) -> int"},
+	} {
+		a, err := Parse(tc.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ctx.InferExpression(a.Root); err == nil || !strings.HasPrefix(err.Error(), tc.want) {
+			t.Errorf("%s: expected %s, found %v", tc.src, tc.want, err)
+		}
+	}
+}
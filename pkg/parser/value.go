@@ -16,7 +16,7 @@ func parseValue(runes []rune, startIdx int) (*Expression, int, error) {
 			continue
 		} else if unicode.IsSpace(r) {
 			break
-		} else if unicode.IsLetter(r) {
+		} else if IsIdentifierRune(r) {
 			break
 		} else if isOp(r) {
 			break
@@ -29,7 +29,7 @@ func parseValue(runes []rune, startIdx int) (*Expression, int, error) {
 	if idx == len(runes)-1 && unicode.IsDigit(runes[idx]) {
 		idx++
 	}
-	e := &Expression{}
+	e := &Expression{Index: startIdx}
 	u, err := strconv.Atoi(string(runes[:idx]))
 	if err != nil {
 		return nil, -1, err
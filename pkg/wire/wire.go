@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const headerContentLength = "Content-Length"
+
+// MaxContentLength is the largest message body read, so a bad header cannot allocate without bound
+const MaxContentLength = 64 << 20
+
+// Read reads the body of a message framed by a Content-Length header, as used by the debug
+// adapter and language server protocols
+func Read(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if len(line) == 0 {
+			break
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) == 2 && strings.EqualFold(strings.TrimSpace(parts[0]), headerContentLength) {
+			length, err = strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				return nil, fmt.Errorf("Invalid %s header `%s`", headerContentLength, line)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("Missing %s header", headerContentLength)
+	}
+	if length > MaxContentLength {
+		return nil, fmt.Errorf("%s %d is larger than the limit of %d bytes", headerContentLength, length, MaxContentLength)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// Write writes the message as json framed by a Content-Length header
+func Write(w io.Writer, msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s: %d\r\n\r\n%s", headerContentLength, len(body), body)
+	return err
+}
@@ -0,0 +1,29 @@
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRead(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := Write(buf, map[string]int{"seq": 1}); err != nil {
+		t.Fatal(err)
+	}
+	body, err := Read(bufio.NewReader(buf))
+	if err != nil || string(body) != `{"seq":1}` {
+		t.Fatalf("Expected the message back, found %s %v", body, err)
+	}
+
+	for _, msg := range []string{
+		"Content-Length: 99999999999\r\n\r\n{}",
+		"Content-Length: x\r\n\r\n{}",
+		"\r\n{}",
+	} {
+		if _, err := Read(bufio.NewReader(strings.NewReader(msg))); err == nil {
+			t.Errorf("%q: expected an error", msg)
+		}
+	}
+}